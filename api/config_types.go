@@ -90,6 +90,35 @@ type RBACConfig struct {
 	Rules         []RBACRuleConfig `yaml:"rules,omitempty"`
 }
 
+// IndexConfig represents the optional trigram search index configuration.
+// Each root is indexed in the background and kept up to date through filesystem notifications.
+type IndexConfig struct {
+	Enabled        bool     `yaml:"enabled"`
+	Roots          []string `yaml:"roots"`
+	MaxFileSize    int64    `yaml:"max_file_size,omitempty"`
+	MaxMemoryBytes int64    `yaml:"max_memory_bytes,omitempty"`
+	StateDir       string   `yaml:"state_dir,omitempty"`
+	MaxDiskBytes   int64    `yaml:"max_disk_bytes,omitempty"`
+}
+
+// UndoConfig bounds the undo history kept for files written through the tools.
+// Zero values select the defaults. Content beyond MaxMemoryBytes, and every version
+// larger than SpillThreshold, is kept on disk. With StateDir set the history survives restarts.
+type UndoConfig struct {
+	MaxVersionsPerPath int           `yaml:"max_versions_per_path,omitempty"`
+	MaxBytes           int64         `yaml:"max_bytes,omitempty"`
+	MaxMemoryBytes     int64         `yaml:"max_memory_bytes,omitempty"`
+	SpillThreshold     int64         `yaml:"spill_threshold,omitempty"`
+	MaxAge             time.Duration `yaml:"max_age,omitempty"`
+	StateDir           string        `yaml:"state_dir,omitempty"`
+}
+
+// ScratchConfig bounds the scratch key-value store. Zero values select the defaults.
+type ScratchConfig struct {
+	MaxKeys  int   `yaml:"max_keys,omitempty"`
+	MaxBytes int64 `yaml:"max_bytes,omitempty"`
+}
+
 // Configuration represents the complete configuration structure
 type Configuration struct {
 	Server                   ServerConfig                 `yaml:"server,omitempty"`
@@ -97,4 +126,7 @@ type Configuration struct {
 	OAuthAuthorizationServer OAuthAuthorizationServer     `yaml:"oauth_authorization_server,omitempty"`
 	OAuthProtectedResource   OAuthProtectedResourceConfig `yaml:"oauth_protected_resource,omitempty"`
 	RBAC                     RBACConfig                   `yaml:"rbac,omitempty"`
+	Index                    IndexConfig                  `yaml:"index,omitempty"`
+	Undo                     UndoConfig                   `yaml:"undo,omitempty"`
+	Scratch                  ScratchConfig                `yaml:"scratch,omitempty"`
 }
@@ -1,13 +1,19 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	//
 	"mcp-forge/internal/globals"
 	"mcp-forge/internal/handlers"
+	"mcp-forge/internal/index"
 	"mcp-forge/internal/middlewares"
 	"mcp-forge/internal/rbac"
 	"mcp-forge/internal/state"
@@ -17,6 +23,9 @@ import (
 	"github.com/mark3labs/mcp-go/server"
 )
 
+// shutdownTimeout bounds how long in-flight HTTP requests are given to finish on shutdown.
+const shutdownTimeout = 10 * time.Second
+
 func main() {
 
 	// 0. Process the configuration
@@ -43,10 +52,26 @@ func main() {
 		log.Fatalf("failed creating RBAC engine: %v", err.Error())
 	}
 
-	// 3. Initialize shared state
-	undoStore := state.NewUndoStore()
-	scratchStore := state.NewScratchStore()
+	// 3. Initialize the optional search index and shared state. A single set of
+	// filesystem notifications serves the index and the tools' own caches
+	watcher, err := index.NewWatcher(appCtx)
+	if err != nil {
+		appCtx.Logger.Error("filesystem notifications unavailable, caches will only refresh when they expire", "error", err.Error())
+	}
+
+	searchIndex, err := index.NewManager(appCtx, watcher)
+	if err != nil {
+		log.Fatalf("failed creating search index: %v", err.Error())
+	}
+	searchIndex.Start()
+
+	undoStore := state.NewUndoStore(appCtx)
+	undoStore.Start()
+	scratchStore := state.NewScratchStore(appCtx.Config.Scratch)
+	scratchStore.Start()
 	processStore := state.NewProcessStore()
+	previewStore := state.NewPreviewStore()
+	cursorStore := state.NewCursorStore()
 
 	// 4. Create a new MCP server
 	mcpServer := server.NewMCPServer(
@@ -70,10 +95,19 @@ func main() {
 		Undo:        undoStore,
 		Scratch:     scratchStore,
 		Processes:   processStore,
+		Previews:    previewStore,
+		Index:       searchIndex,
+		Watcher:     watcher,
+		Cursors:     cursorStore,
 	})
 	tm.AddTools()
 
-	// 7. Wrap MCP server in a transport (stdio, HTTP, SSE)
+	// 7. Stop serving when the process is asked to stop
+	ctx, stop := signal.NotifyContext(appCtx.Context, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// 8. Wrap MCP server in a transport (stdio, HTTP, SSE)
+	var serveErr error
 	switch appCtx.Config.Server.Transport.Type {
 	case "http":
 		httpServer := server.NewStreamableHTTPServer(mcpServer,
@@ -93,16 +127,37 @@ func main() {
 				accessLogsMw.Middleware(http.HandlerFunc(hm.HandleOauthProtectedResources)))
 		}
 
+		srv := &http.Server{Addr: appCtx.Config.Server.Transport.HTTP.Host, Handler: mux}
+		shutdownDone := make(chan struct{})
+		go func() {
+			defer close(shutdownDone)
+			<-ctx.Done()
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+			defer cancel()
+			if err := srv.Shutdown(shutdownCtx); err != nil {
+				appCtx.Logger.Error("failed shutting down StreamableHTTP server", "error", err.Error())
+			}
+		}()
+
 		appCtx.Logger.Info("starting StreamableHTTP server", "host", appCtx.Config.Server.Transport.HTTP.Host)
-		err := http.ListenAndServe(appCtx.Config.Server.Transport.HTTP.Host, mux)
-		if err != nil {
-			log.Fatal(err)
+		serveErr = srv.ListenAndServe()
+		if errors.Is(serveErr, http.ErrServerClosed) {
+			// ListenAndServe returns as soon as shutdown starts: let in-flight requests finish
+			<-shutdownDone
+			serveErr = nil
 		}
 
 	default:
 		appCtx.Logger.Info("starting stdio server")
-		if err := server.ServeStdio(mcpServer); err != nil {
-			log.Fatal(err)
+		serveErr = server.NewStdioServer(mcpServer).Listen(ctx, os.Stdin, os.Stdout)
+		if errors.Is(serveErr, context.Canceled) {
+			serveErr = nil
 		}
 	}
+
+	// 9. Write out the pending undo history once nothing can change it anymore
+	undoStore.Close()
+	if serveErr != nil {
+		log.Fatal(serveErr)
+	}
 }
@@ -0,0 +1,391 @@
+package index
+
+import (
+	"bytes"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	//
+	"mcp-forge/api"
+	"mcp-forge/internal/globals"
+)
+
+const (
+	defaultMaxFileSize    = 10 * 1024 * 1024
+	defaultMaxMemoryBytes = 256 * 1024 * 1024
+	defaultMaxDiskBytes   = 1024 * 1024 * 1024
+
+	// binarySniffSize matches the heuristic used by search: a NUL byte in the first few KB
+	binarySniffSize = 8000
+
+	// entryOverhead approximates the per-file bookkeeping cost beyond the trigram set
+	entryOverhead = 96
+
+	// persistInterval is how often dirty indexes are written to the state directory
+	persistInterval = time.Minute
+
+	// mtimeGranularity is the coarsest modification time resolution among common
+	// filesystems (FAT stores two-second timestamps)
+	mtimeGranularity = 2 * time.Second
+)
+
+// fileEntry is the indexed state of a single file. Size and ModTime identify the
+// version of the file the trigrams were computed from, and IndexedAt is when it was read.
+type fileEntry struct {
+	Size      int64
+	ModTime   int64
+	IndexedAt int64
+	Trigrams  []uint32
+}
+
+// racy reports whether the file may have been written again without its size or
+// modification time changing: a write within the same timestamp tick as the one that
+// was indexed is invisible to a size and mtime comparison. Racy entries are never
+// trusted to skip a file.
+func (e *fileEntry) racy() bool {
+	return e.ModTime >= e.IndexedAt-int64(mtimeGranularity)
+}
+
+// matches reports whether info describes the version of the file the entry was built from.
+func (e *fileEntry) matches(info fs.FileInfo) bool {
+	return !e.racy() && e.Size == info.Size() && e.ModTime == info.ModTime().UnixNano()
+}
+
+func (e *fileEntry) cost(path string) int64 {
+	return int64(len(e.Trigrams)*4+len(path)) + entryOverhead
+}
+
+type rootIndex struct {
+	path  string
+	files map[string]*fileEntry
+	dirty bool
+}
+
+// Manager maintains a trigram index for every configured root. The index only narrows
+// down which files are worth scanning; it never decides a match on its own, so results
+// are identical to a scan without it.
+type Manager struct {
+	appCtx *globals.ApplicationContext
+	config api.IndexConfig
+
+	mu         sync.RWMutex
+	roots      []*rootIndex
+	memoryUsed int64
+	memoryFull bool
+	watcher    *Watcher
+	watched    map[string]bool
+
+	pendingMu sync.Mutex
+	pending   map[string]bool
+}
+
+// NewManager creates the index manager from the index configuration section. Changes are
+// followed through watcher, which may be nil. When indexing is disabled the manager is
+// inert and every file is a candidate.
+func NewManager(appCtx *globals.ApplicationContext, watcher *Watcher) (*Manager, error) {
+	m := &Manager{
+		appCtx:  appCtx,
+		config:  appCtx.Config.Index,
+		watcher: watcher,
+		watched: make(map[string]bool),
+		pending: make(map[string]bool),
+	}
+
+	if !m.config.Enabled {
+		return m, nil
+	}
+
+	if m.config.MaxFileSize <= 0 {
+		m.config.MaxFileSize = defaultMaxFileSize
+	}
+	if m.config.MaxMemoryBytes <= 0 {
+		m.config.MaxMemoryBytes = defaultMaxMemoryBytes
+	}
+	if m.config.MaxDiskBytes <= 0 {
+		m.config.MaxDiskBytes = defaultMaxDiskBytes
+	}
+
+	for _, root := range m.config.Roots {
+		absRoot, err := filepath.Abs(root)
+		if err != nil {
+			return nil, err
+		}
+		m.roots = append(m.roots, &rootIndex{
+			path:  absRoot,
+			files: make(map[string]*fileEntry),
+		})
+	}
+
+	return m, nil
+}
+
+// Start loads persisted indexes, then builds and watches every root in the background.
+func (m *Manager) Start() {
+	if !m.config.Enabled || len(m.roots) == 0 {
+		return
+	}
+
+	if m.watcher == nil {
+		m.appCtx.Logger.Error("index: filesystem notifications unavailable, files changed after indexing will always be scanned")
+	}
+	for _, root := range m.roots {
+		m.watcher.Listen(root.path, m.queueEvent, func(error) {})
+	}
+	go m.flushLoop()
+
+	go func() {
+		for _, root := range m.roots {
+			m.load(root)
+			started := time.Now()
+			m.build(root)
+			m.appCtx.Logger.Info("index: root indexed", "root", root.path, "files", m.fileCount(root), "took", time.Since(started).String())
+			m.persist(root)
+		}
+	}()
+
+	if m.config.StateDir != "" {
+		go m.persistLoop()
+	}
+}
+
+// Skip reports whether path can be left out of a scan for q. It only returns true when the
+// file is indexed, the index entry matches the file's current size and modification time
+// and was not read within the timestamp granularity of the file's last write, and the file
+// lacks at least one trigram the query requires.
+func (m *Manager) Skip(path string, info fs.FileInfo, q Query) bool {
+	if !m.config.Enabled || q.MatchesAll() || info == nil {
+		return false
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	root := m.rootFor(path)
+	if root == nil {
+		return false
+	}
+
+	entry, ok := root.files[path]
+	if !ok || !entry.matches(info) {
+		return false
+	}
+
+	return !containsAll(entry.Trigrams, q.trigrams)
+}
+
+// Enabled reports whether the index is configured for at least one root.
+func (m *Manager) Enabled() bool {
+	return m.config.Enabled && len(m.roots) > 0
+}
+
+func (m *Manager) rootFor(path string) *rootIndex {
+	for _, root := range m.roots {
+		if path == root.path || strings.HasPrefix(path, root.path+string(filepath.Separator)) {
+			return root
+		}
+	}
+	return nil
+}
+
+func (m *Manager) fileCount(root *rootIndex) int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return len(root.files)
+}
+
+// build walks root, indexing files that are new or changed since they were last indexed,
+// and forgets files that no longer exist.
+func (m *Manager) build(root *rootIndex) {
+	seen := m.indexDir(root.path)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for path, entry := range root.files {
+		if !seen[path] {
+			m.memoryUsed -= entry.cost(path)
+			delete(root.files, path)
+			root.dirty = true
+		}
+	}
+}
+
+// indexDir indexes every regular file below dir and watches its directories.
+// Returns the set of files found.
+func (m *Manager) indexDir(dir string) map[string]bool {
+	seen := make(map[string]bool)
+
+	_ = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+
+		if d.IsDir() {
+			if d.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			m.watch(path)
+			return nil
+		}
+
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		seen[path] = true
+		m.update(path)
+		return nil
+	})
+
+	return seen
+}
+
+// watch starts watching dir unless the index already holds a watch on it, so walking a
+// directory again does not pile up references that are never released.
+func (m *Manager) watch(dir string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.watched[dir] {
+		return
+	}
+	// Failures, typically from exhausting the inotify watch limit, are otherwise
+	// ignored: stale entries are detected at query time
+	if err := m.watcher.Add(dir); err != nil {
+		m.appCtx.Logger.Debug("index: failed watching directory", "path", dir, "error", err.Error())
+		return
+	}
+	m.watched[dir] = true
+}
+
+// update re-indexes a single file if its size or modification time changed, or if its
+// entry is racy. Files that disappeared are removed from the index.
+func (m *Manager) update(path string) {
+	m.mu.RLock()
+	root := m.rootFor(path)
+	m.mu.RUnlock()
+	if root == nil {
+		return
+	}
+
+	info, err := os.Stat(path)
+	if err != nil || !info.Mode().IsRegular() {
+		m.remove(path)
+		return
+	}
+
+	m.mu.RLock()
+	entry, ok := root.files[path]
+	m.mu.RUnlock()
+	if ok && entry.matches(info) {
+		return
+	}
+
+	if info.Size() > m.config.MaxFileSize {
+		m.remove(path)
+		return
+	}
+
+	data, err := readIndexable(path)
+	if err != nil || data == nil {
+		m.remove(path)
+		return
+	}
+
+	newEntry := &fileEntry{
+		Size:      info.Size(),
+		ModTime:   info.ModTime().UnixNano(),
+		IndexedAt: time.Now().UnixNano(),
+		Trigrams:  trigramSet(data),
+	}
+
+	// A file read right after being written is read again once its timestamp has aged,
+	// so that it does not stay racy and always scanned. Future timestamps never age.
+	if newEntry.racy() && newEntry.ModTime <= newEntry.IndexedAt {
+		m.pendingMu.Lock()
+		m.pending[path] = true
+		m.pendingMu.Unlock()
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if old, ok := root.files[path]; ok {
+		m.memoryUsed -= old.cost(path)
+		delete(root.files, path)
+	}
+
+	// Files that do not fit in the memory budget stay unindexed and are always scanned
+	if m.memoryUsed+newEntry.cost(path) > m.config.MaxMemoryBytes {
+		if !m.memoryFull {
+			m.memoryFull = true
+			m.appCtx.Logger.Warn("index: memory limit reached, files that do not fit will not be indexed", "max_memory_bytes", m.config.MaxMemoryBytes)
+		}
+		root.dirty = true
+		return
+	}
+
+	root.files[path] = newEntry
+	m.memoryUsed += newEntry.cost(path)
+	root.dirty = true
+}
+
+// remove drops path, and every indexed file and watched directory below it, from the index.
+func (m *Manager) remove(path string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	prefix := path + string(filepath.Separator)
+	for dir := range m.watched {
+		if dir == path || strings.HasPrefix(dir, prefix) {
+			m.watcher.Remove(dir)
+			delete(m.watched, dir)
+		}
+	}
+
+	root := m.rootFor(path)
+	if root == nil {
+		return
+	}
+
+	for p, entry := range root.files {
+		if p == path || strings.HasPrefix(p, prefix) {
+			m.memoryUsed -= entry.cost(p)
+			delete(root.files, p)
+			root.dirty = true
+		}
+	}
+
+	// Warn again the next time the limit is reached, once enough memory was freed
+	if m.memoryUsed <= m.config.MaxMemoryBytes/2 {
+		m.memoryFull = false
+	}
+}
+
+// readIndexable returns the content of path, or nil when the file looks binary.
+func readIndexable(path string) ([]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return nil, err
+	}
+
+	head := data
+	if len(head) > binarySniffSize {
+		head = head[:binarySniffSize]
+	}
+	if bytes.IndexByte(head, 0) != -1 {
+		return nil, nil
+	}
+
+	return data, nil
+}
@@ -0,0 +1,110 @@
+package index
+
+import (
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+
+	//
+	"mcp-forge/api"
+	"mcp-forge/internal/globals"
+)
+
+func newTestManager(t *testing.T, root string, watcher *Watcher) *Manager {
+	t.Helper()
+
+	appCtx := &globals.ApplicationContext{
+		Logger: slog.New(slog.NewTextHandler(io.Discard, nil)),
+		Config: &api.Configuration{Index: api.IndexConfig{Enabled: true, Roots: []string{root}}},
+	}
+	m, err := NewManager(appCtx, watcher)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestSkipRacyEntry(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "file.txt")
+	if err := os.WriteFile(path, []byte("hello world"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	m := newTestManager(t, dir, nil)
+	m.update(path)
+
+	stat := func() os.FileInfo {
+		t.Helper()
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return info
+	}
+	q := NewQuery(regexp.MustCompile("needle"))
+
+	// Rewritten within the same timestamp tick: size and mtime match the index entry
+	info := stat()
+	if err := os.WriteFile(path, []byte("needle here"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, info.ModTime(), info.ModTime()); err != nil {
+		t.Fatal(err)
+	}
+	if m.Skip(path, stat(), q) {
+		t.Fatal("skipped a file rewritten right after it was indexed")
+	}
+
+	// Once read again long after its last write, the entry is trusted
+	old := time.Now().Add(-time.Hour)
+	if err := os.WriteFile(path, []byte("hello world"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, old, old); err != nil {
+		t.Fatal(err)
+	}
+	m.update(path)
+	if !m.Skip(path, stat(), q) {
+		t.Fatal("did not skip an unchanged file lacking the query trigrams")
+	}
+}
+
+func TestIndexDirWatchesOnce(t *testing.T) {
+	dir := t.TempDir()
+	sub := filepath.Join(dir, "sub")
+	if err := os.Mkdir(sub, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	appCtx := &globals.ApplicationContext{Logger: slog.New(slog.NewTextHandler(io.Discard, nil))}
+	watcher, err := NewWatcher(appCtx)
+	if err != nil {
+		t.Skip("filesystem notifications unavailable:", err)
+	}
+	t.Cleanup(func() { _ = watcher.fsw.Close() })
+	m := newTestManager(t, dir, watcher)
+
+	m.indexDir(dir)
+	m.indexDir(sub)
+	m.indexDir(dir)
+
+	watcher.mu.Lock()
+	refs := watcher.dirs[sub]
+	watcher.mu.Unlock()
+	if refs != 1 {
+		t.Fatalf("sub watched %d times, want 1", refs)
+	}
+
+	m.remove(sub)
+	watcher.mu.Lock()
+	refs = watcher.dirs[sub]
+	watcher.mu.Unlock()
+	if refs != 0 {
+		t.Fatalf("sub still watched %d times after removal", refs)
+	}
+}
@@ -0,0 +1,111 @@
+package index
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"time"
+
+	//
+	"mcp-forge/internal/fileutil"
+)
+
+// persistVersion is bumped whenever the on-disk layout changes; files with another
+// version are ignored and rebuilt from scratch.
+const persistVersion = 2
+
+type persistedIndex struct {
+	Version int
+	Root    string
+	Files   map[string]*fileEntry
+}
+
+func (m *Manager) indexFile(root *rootIndex) string {
+	sum := sha256.Sum256([]byte(root.path))
+	return filepath.Join(m.config.StateDir, "index-"+hex.EncodeToString(sum[:8])+".gob")
+}
+
+// load seeds root from its persisted index. Entries are revalidated by the build that
+// follows, so only files changed while the server was down need to be read again.
+func (m *Manager) load(root *rootIndex) {
+	if m.config.StateDir == "" {
+		return
+	}
+
+	data, err := os.ReadFile(m.indexFile(root))
+	if err != nil {
+		return
+	}
+
+	var persisted persistedIndex
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&persisted); err != nil {
+		m.appCtx.Logger.Warn("index: ignoring unreadable persisted index", "root", root.path, "error", err.Error())
+		return
+	}
+	if persisted.Version != persistVersion || persisted.Root != root.path {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for path, entry := range persisted.Files {
+		if m.memoryUsed+entry.cost(path) > m.config.MaxMemoryBytes {
+			break
+		}
+		root.files[path] = entry
+		m.memoryUsed += entry.cost(path)
+	}
+}
+
+// persist writes root to the state directory if it changed since the last write and
+// the encoded index fits within the configured disk limit.
+func (m *Manager) persist(root *rootIndex) {
+	if m.config.StateDir == "" {
+		return
+	}
+
+	m.mu.Lock()
+	if !root.dirty {
+		m.mu.Unlock()
+		return
+	}
+	var buf bytes.Buffer
+	err := gob.NewEncoder(&buf).Encode(persistedIndex{
+		Version: persistVersion,
+		Root:    root.path,
+		Files:   root.files,
+	})
+	root.dirty = false
+	m.mu.Unlock()
+
+	if err != nil {
+		m.appCtx.Logger.Error("index: failed encoding index", "root", root.path, "error", err.Error())
+		return
+	}
+
+	if int64(buf.Len()) > m.config.MaxDiskBytes {
+		m.appCtx.Logger.Warn("index: encoded index exceeds max_disk_bytes, not persisting",
+			"root", root.path, "size", buf.Len(), "max_disk_bytes", m.config.MaxDiskBytes)
+		_ = os.Remove(m.indexFile(root))
+		return
+	}
+
+	if err := fileutil.WriteFileAtomic(m.indexFile(root), buf.Bytes()); err != nil {
+		m.appCtx.Logger.Error("index: failed persisting index", "root", root.path, "error", err.Error())
+	}
+}
+
+func (m *Manager) persistLoop() {
+	ticker := time.NewTicker(persistInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		for _, root := range m.roots {
+			m.persist(root)
+		}
+	}
+}
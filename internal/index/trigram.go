@@ -0,0 +1,137 @@
+package index
+
+import (
+	"regexp"
+	"regexp/syntax"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+// Query is the set of trigrams that any text matching a regex must contain.
+// An empty query matches every file.
+type Query struct {
+	trigrams []uint32
+}
+
+// MatchesAll reports whether the query cannot rule out any file.
+func (q Query) MatchesAll() bool {
+	return len(q.trigrams) == 0
+}
+
+// NewQuery derives the trigrams required by re. The derivation is conservative:
+// whenever a construct could match without a given literal, that literal is dropped,
+// so a file is only ruled out when it cannot possibly match.
+func NewQuery(re *regexp.Regexp) Query {
+	parsed, err := syntax.Parse(re.String(), syntax.Perl)
+	if err != nil {
+		return Query{}
+	}
+
+	var trigrams []uint32
+	for _, literal := range requiredLiterals(parsed.Simplify()) {
+		trigrams = append(trigrams, trigramsOf([]byte(literal))...)
+	}
+	slices.Sort(trigrams)
+	return Query{trigrams: slices.Compact(trigrams)}
+}
+
+// requiredLiterals returns strings that every match of re must contain.
+func requiredLiterals(re *syntax.Regexp) []string {
+	switch re.Op {
+	case syntax.OpLiteral:
+		if literal, ok := exactLiteral(re); ok {
+			return []string{literal}
+		}
+		return nil
+
+	case syntax.OpCapture:
+		return requiredLiterals(re.Sub[0])
+
+	case syntax.OpPlus:
+		return requiredLiterals(re.Sub[0])
+
+	case syntax.OpRepeat:
+		if re.Min >= 1 {
+			return requiredLiterals(re.Sub[0])
+		}
+		return nil
+
+	case syntax.OpConcat:
+		// Adjacent literals form a longer run, which yields trigrams across their boundary
+		var result []string
+		var run strings.Builder
+		flush := func() {
+			if run.Len() > 0 {
+				result = append(result, run.String())
+				run.Reset()
+			}
+		}
+		for _, sub := range re.Sub {
+			if literal, ok := exactLiteral(sub); ok {
+				run.WriteString(literal)
+				continue
+			}
+			flush()
+			result = append(result, requiredLiterals(sub)...)
+		}
+		flush()
+		return result
+	}
+
+	return nil
+}
+
+// exactLiteral returns the text of a case-sensitive literal node. Literals containing
+// the replacement character are rejected, since the regexp engine also matches it
+// against invalid UTF-8 bytes that never appear in the indexed content.
+func exactLiteral(re *syntax.Regexp) (string, bool) {
+	if re.Op != syntax.OpLiteral || re.Flags&syntax.FoldCase != 0 {
+		return "", false
+	}
+	literal := string(re.Rune)
+	if strings.ContainsRune(literal, utf8.RuneError) {
+		return "", false
+	}
+	return literal, true
+}
+
+// trigramsOf returns every trigram in data, possibly with duplicates.
+func trigramsOf(data []byte) []uint32 {
+	if len(data) < 3 {
+		return nil
+	}
+	trigrams := make([]uint32, 0, len(data)-2)
+	for i := 0; i+2 < len(data); i++ {
+		trigrams = append(trigrams, uint32(data[i])<<16|uint32(data[i+1])<<8|uint32(data[i+2]))
+	}
+	return trigrams
+}
+
+// trigramSet returns the sorted, distinct trigrams of data.
+func trigramSet(data []byte) []uint32 {
+	seen := make(map[uint32]struct{}, 1024)
+	for i := 0; i+2 < len(data); i++ {
+		seen[uint32(data[i])<<16|uint32(data[i+1])<<8|uint32(data[i+2])] = struct{}{}
+	}
+	set := make([]uint32, 0, len(seen))
+	for t := range seen {
+		set = append(set, t)
+	}
+	slices.Sort(set)
+	return set
+}
+
+// containsAll reports whether the sorted set holds every trigram of the sorted query.
+func containsAll(set []uint32, query []uint32) bool {
+	i := 0
+	for _, t := range query {
+		for i < len(set) && set[i] < t {
+			i++
+		}
+		if i == len(set) || set[i] != t {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,205 @@
+package index
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	//
+	"mcp-forge/internal/globals"
+
+	//
+	"github.com/fsnotify/fsnotify"
+)
+
+// watchDebounce is how long events are collected before the affected files are re-indexed,
+// so a burst of writes to the same file is processed once.
+const watchDebounce = 500 * time.Millisecond
+
+// errWatcherUnavailable is returned by a nil Watcher, when notifications could not be set up.
+var errWatcherUnavailable = errors.New("filesystem notifications are unavailable")
+
+// Watcher shares one set of filesystem notifications between the index and the other
+// caches that need to know when a tree changes. Directories are reference counted, so a
+// consumer that stops watching one does not blind the others. A nil Watcher is valid
+// and watches nothing.
+type Watcher struct {
+	appCtx *globals.ApplicationContext
+	fsw    *fsnotify.Watcher
+
+	mu        sync.Mutex
+	dirs      map[string]int
+	listeners map[int]*watchListener
+	nextID    int
+}
+
+// watchListener receives the notifications for paths below root. onError is called when
+// notifications may have been lost.
+type watchListener struct {
+	root    string
+	onEvent func(event fsnotify.Event)
+	onError func(err error)
+}
+
+func NewWatcher(appCtx *globals.ApplicationContext) (*Watcher, error) {
+	fsw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+
+	w := &Watcher{
+		appCtx:    appCtx,
+		fsw:       fsw,
+		dirs:      make(map[string]int),
+		listeners: make(map[int]*watchListener),
+	}
+	go w.run()
+	return w, nil
+}
+
+// Add starts watching a directory. It typically fails when the inotify watch limit is
+// exhausted, in which case changes inside dir go unnoticed.
+func (w *Watcher) Add(dir string) error {
+	if w == nil {
+		return errWatcherUnavailable
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.dirs[dir] == 0 {
+		if err := w.fsw.Add(dir); err != nil {
+			return err
+		}
+	}
+	w.dirs[dir]++
+	return nil
+}
+
+// Remove releases a directory added with Add, and stops watching it once nobody needs it.
+func (w *Watcher) Remove(dir string) {
+	if w == nil {
+		return
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.dirs[dir] == 0 {
+		return
+	}
+	w.dirs[dir]--
+	if w.dirs[dir] == 0 {
+		delete(w.dirs, dir)
+		_ = w.fsw.Remove(dir)
+	}
+}
+
+// Listen calls onEvent for every notification about root or a path below it, and onError
+// whenever notifications were dropped. Both run on the watcher goroutine and must not block.
+// The returned function stops the listener.
+func (w *Watcher) Listen(root string, onEvent func(event fsnotify.Event), onError func(err error)) func() {
+	if w == nil {
+		return func() {}
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	id := w.nextID
+	w.nextID++
+	w.listeners[id] = &watchListener{root: root, onEvent: onEvent, onError: onError}
+
+	return func() {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		delete(w.listeners, id)
+	}
+}
+
+func (w *Watcher) run() {
+	for {
+		select {
+		case event, ok := <-w.fsw.Events:
+			if !ok {
+				return
+			}
+			if event.Op&(fsnotify.Remove|fsnotify.Rename) != 0 {
+				w.forget(event.Name)
+			}
+			for _, l := range w.snapshot() {
+				if event.Name == l.root || strings.HasPrefix(event.Name, l.root+string(filepath.Separator)) {
+					l.onEvent(event)
+				}
+			}
+
+		case err, ok := <-w.fsw.Errors:
+			if !ok {
+				return
+			}
+			w.appCtx.Logger.Error("filesystem watcher error", "error", err.Error())
+			for _, l := range w.snapshot() {
+				l.onError(err)
+			}
+		}
+	}
+}
+
+// forget drops a directory that was removed or renamed away, which the kernel stops
+// watching on its own, so that a directory created later under the same name is watched again.
+func (w *Watcher) forget(dir string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	delete(w.dirs, dir)
+}
+
+func (w *Watcher) snapshot() []*watchListener {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	listeners := make([]*watchListener, 0, len(w.listeners))
+	for _, l := range w.listeners {
+		listeners = append(listeners, l)
+	}
+	return listeners
+}
+
+// queueEvent records a changed path to be re-indexed by the next flush.
+func (m *Manager) queueEvent(event fsnotify.Event) {
+	m.pendingMu.Lock()
+	m.pending[event.Name] = true
+	m.pendingMu.Unlock()
+}
+
+// flushLoop re-indexes the paths queued by notifications every watchDebounce.
+func (m *Manager) flushLoop() {
+	ticker := time.NewTicker(watchDebounce)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		m.flush()
+	}
+}
+
+func (m *Manager) flush() {
+	m.pendingMu.Lock()
+	paths := m.pending
+	m.pending = make(map[string]bool)
+	m.pendingMu.Unlock()
+
+	for path := range paths {
+		info, err := os.Stat(path)
+		switch {
+		case err != nil:
+			m.remove(path)
+		case info.IsDir():
+			// New or moved-in directories are walked so their files get indexed and watched
+			m.indexDir(path)
+		default:
+			m.update(path)
+		}
+	}
+}
@@ -66,16 +66,23 @@ func NewEngine(appCtx *globals.ApplicationContext) (*Engine, error) {
 
 // operationCategory maps tool names to their operation category
 var operationCategory = map[string]string{
-	"ls":             "read",
-	"read_file":      "read",
-	"search":         "read",
-	"diff":           "read",
-	"write_file":     "write",
-	"edit_file":      "write",
-	"undo":           "write",
-	"exec":           "exec",
-	"process_status": "exec",
-	"process_kill":   "exec",
+	"ls":               "read",
+	"read_file":        "read",
+	"search":           "read",
+	"diff":             "read",
+	"find_file":        "read",
+	"symbols":          "read",
+	"write_file":       "write",
+	"edit_file":        "write",
+	"replace_in_files": "write",
+	"merge":            "write",
+	"undo":             "write",
+	"redo":             "write",
+	"checkpoint":       "write",
+	"undo_history":     "read",
+	"exec":             "exec",
+	"process_status":   "exec",
+	"process_kill":     "exec",
 }
 
 // pathFreeTools are tools that don't operate on filesystem paths
@@ -109,6 +116,28 @@ func (e *Engine) Check(toolName string, paths []string, jwtPayload map[string]an
 	return nil
 }
 
+// Grants reports whether a rule explicitly allows operation on path. Unlike Check it
+// ignores the default policy, and is false when RBAC is disabled: it guards privileges
+// that must be handed out on purpose, such as undo_any.
+func (e *Engine) Grants(operation string, path string, jwtPayload map[string]any) bool {
+	if !e.appCtx.Config.RBAC.Enabled {
+		return false
+	}
+
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+
+	for _, rule := range e.rules {
+		if e.matchesWhen(rule, jwtPayload) && matchesPath(rule.config.Paths, absPath) &&
+			matchesOperation(rule.config.Operations, operation) {
+			return true
+		}
+	}
+	return false
+}
+
 func (e *Engine) checkPath(operation string, path string, jwtPayload map[string]any) error {
 	absPath, err := filepath.Abs(path)
 	if err != nil {
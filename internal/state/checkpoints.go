@@ -0,0 +1,407 @@
+package state
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"time"
+)
+
+// maxCheckpoints bounds how many named checkpoints each caller can have at once.
+const maxCheckpoints = 32
+
+// checkpoint remembers, for every path written through the tools since it was created,
+// the state that path had at checkpoint time. An operation checkpoint is instead
+// created after the fact for one change spanning several files, such as an exec
+// command, and does not record later writes. tooLarge lists the changed paths whose
+// earlier state was too large to keep, which a rollback cannot restore.
+type checkpoint struct {
+	name      string
+	createdAt time.Time
+	owner     UndoOrigin
+	operation bool
+	files     map[string]*UndoVersion
+	tooLarge  map[string]bool
+}
+
+// CheckpointInfo describes a checkpoint and the files changed since it was created.
+type CheckpointInfo struct {
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+	Session   string    `json:"session,omitempty"`
+	Subject   string    `json:"subject,omitempty"`
+	Operation bool      `json:"operation,omitempty"`
+	Files     []string  `json:"files"`
+}
+
+// UndoFileState is the state of a file before a change made outside the tools.
+type UndoFileState struct {
+	Path    string
+	Content []byte
+	Existed bool
+}
+
+// CheckpointFile is one file touched by a rollback. Action is "restored" for a file put
+// back to its earlier content, "removed" for a file created after the checkpoint, and
+// "recreated" for a file deleted after it.
+type CheckpointFile struct {
+	Path   string `json:"path"`
+	Action string `json:"action"`
+	Error  string `json:"error,omitempty"`
+}
+
+// CreateCheckpoint starts recording the files changed from now on under name. The
+// checkpoint belongs to origin, and names only need to be unique among its checkpoints.
+func (u *UndoStore) CreateCheckpoint(name string, origin UndoOrigin) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	owned := u.ownedCheckpoints(origin)
+	for _, cp := range owned {
+		if cp.name == name {
+			return fmt.Errorf("checkpoint %q already exists", name)
+		}
+	}
+	if len(owned) >= maxCheckpoints {
+		return fmt.Errorf("too many checkpoints (max %d), delete one first", maxCheckpoints)
+	}
+
+	u.checkpoints = append(u.checkpoints, &checkpoint{
+		name:      name,
+		createdAt: time.Now(),
+		owner:     origin,
+		files:     make(map[string]*UndoVersion),
+	})
+	u.sync()
+	return nil
+}
+
+// Checkpoints lists the checkpoints of origin, oldest first. Checkpoints of others are
+// listed only when override reports true for their files.
+func (u *UndoStore) Checkpoints(origin UndoOrigin, override func(files []string) bool) []CheckpointInfo {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	infos := make([]CheckpointInfo, 0, len(u.checkpoints))
+	for _, cp := range u.checkpoints {
+		if !cp.owner.ownedBy(origin) && !override(cp.paths()) {
+			continue
+		}
+		infos = append(infos, CheckpointInfo{
+			Name:      cp.name,
+			CreatedAt: cp.createdAt,
+			Session:   cp.owner.Session,
+			Subject:   cp.owner.Subject,
+			Operation: cp.operation,
+			Files:     cp.paths(),
+		})
+	}
+	return infos
+}
+
+// RecordOperation registers files changed together at startedAt, e.g. by a command, as
+// one operation. Each earlier state becomes an undo version of its path, and a rollback
+// of the returned operation checkpoint restores them all at once. When the checkpoint
+// limit is reached the oldest operation checkpoint makes room; without one the changes
+// can still be undone file by file and an error is returned.
+func (u *UndoStore) RecordOperation(label string, files []UndoFileState, origin UndoOrigin, startedAt time.Time) (string, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	cp := &checkpoint{
+		createdAt: startedAt,
+		owner:     origin,
+		operation: true,
+		files:     make(map[string]*UndoVersion),
+	}
+	for _, file := range files {
+		u.counter++
+		version := &UndoVersion{
+			ID:        fmt.Sprintf("v%d", u.counter),
+			Path:      file.Path,
+			Content:   file.Content,
+			Size:      int64(len(file.Content)),
+			Existed:   file.Existed,
+			CreatedAt: startedAt,
+			Origin:    origin,
+		}
+		if cp.name == "" {
+			cp.name = label + "-" + version.ID
+		}
+
+		u.touch(file.Path)
+		u.clearRedo(file.Path)
+		u.recordCheckpoints(version)
+
+		if err := u.push(file.Path, version); err != nil {
+			cp.markTooLarge(file.Path)
+			continue
+		}
+		recorded := *version
+		cp.files[file.Path] = &recorded
+		u.hold(&recorded)
+	}
+	defer u.sync()
+
+	if len(cp.files) == 0 && len(cp.tooLarge) == 0 {
+		return "", nil
+	}
+	if len(u.ownedCheckpoints(origin)) >= maxCheckpoints {
+		oldest := -1
+		for i, existing := range u.checkpoints {
+			if existing.operation && existing.owner.owner() == origin.owner() {
+				oldest = i
+				break
+			}
+		}
+		if oldest < 0 {
+			u.releaseCheckpointFiles(cp)
+			return "", fmt.Errorf("too many checkpoints (max %d) to register %s as one operation", maxCheckpoints, cp.name)
+		}
+		u.removeCheckpoints(oldest, oldest+1)
+	}
+	u.checkpoints = append(u.checkpoints, cp)
+	return cp.name, nil
+}
+
+// CheckpointFiles returns the files a rollback to name would touch.
+func (u *UndoStore) CheckpointFiles(name string, origin UndoOrigin) ([]string, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	index, err := u.checkpointIndex(name, origin)
+	if err != nil {
+		return nil, err
+	}
+	return u.checkpoints[index].paths(), nil
+}
+
+// DeleteCheckpoint forgets a checkpoint without touching any file. Only its owner can
+// delete it, unless override is set.
+func (u *UndoStore) DeleteCheckpoint(name string, origin UndoOrigin, override bool) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	index, err := u.checkpointIndex(name, origin)
+	if err != nil {
+		return err
+	}
+	if !override && !u.checkpoints[index].owner.ownedBy(origin) {
+		return fmt.Errorf("checkpoint %q belongs to another session", name)
+	}
+	u.removeCheckpoints(index, index+1)
+	u.sync()
+	return nil
+}
+
+// Rollback puts every file changed since the checkpoint back to its state at that time.
+// Each file's current state is saved as an undo version first, so a single file can
+// still be brought forward again. The owner's checkpoints created after this one are
+// discarded, while this one stays and starts recording afresh; an operation checkpoint
+// is done once rolled back and goes away instead. Unless override is set,
+// only the owner can roll back, and only when nobody else changed those files since.
+func (u *UndoStore) Rollback(name string, origin UndoOrigin, override bool) ([]CheckpointFile, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	index, err := u.checkpointIndex(name, origin)
+	if err != nil {
+		return nil, err
+	}
+	cp := u.checkpoints[index]
+
+	if !override {
+		if !cp.owner.ownedBy(origin) {
+			return nil, fmt.Errorf("checkpoint %q belongs to another session", name)
+		}
+		for path := range cp.files {
+			for _, version := range u.entries[path] {
+				if version.CreatedAt.After(cp.createdAt) && !version.Origin.ownedBy(origin) {
+					return nil, undoConflict(path, version)
+				}
+			}
+		}
+	}
+
+	// Files that could not be rolled back stay recorded so that a retry covers them
+	var results []CheckpointFile
+	failed := make(map[string]*UndoVersion)
+	for _, path := range cp.paths() {
+		version, ok := cp.files[path]
+		result := CheckpointFile{Path: path, Action: "restored"}
+		if !ok {
+			result.Error = "its earlier state was too large to keep in the undo history"
+			results = append(results, result)
+			continue
+		}
+
+		current, err := u.capture(path, origin)
+		if err != nil {
+			result.Error = err.Error()
+			results = append(results, result)
+			failed[path] = version
+			continue
+		}
+
+		content, err := u.content(version)
+		if err != nil {
+			result.Error = err.Error()
+			results = append(results, result)
+			failed[path] = version
+			continue
+		}
+
+		// Changed and then changed back: nothing to do
+		if current.Existed == version.Existed && bytes.Equal(current.Content, content) {
+			continue
+		}
+
+		switch {
+		case !version.Existed:
+			result.Action = "removed"
+		case !current.Existed:
+			result.Action = "recreated"
+		}
+
+		if version.Existed {
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				result.Error = err.Error()
+				results = append(results, result)
+				failed[path] = version
+				continue
+			}
+		}
+		if err := u.writeVersion(version); err != nil {
+			result.Error = err.Error()
+			results = append(results, result)
+			failed[path] = version
+			continue
+		}
+
+		u.touch(path)
+		u.clearRedo(path)
+		u.recordCheckpoints(current)
+		if err := u.push(path, current); err != nil {
+			u.appCtx.Logger.Warn("undo: rollback cannot be undone", "error", err.Error())
+		}
+		results = append(results, result)
+	}
+
+	for i := len(u.checkpoints) - 1; i > index && !cp.operation; i-- {
+		if u.checkpoints[i].owner.owner() == cp.owner.owner() && !u.checkpoints[i].operation {
+			u.removeCheckpoints(i, i+1)
+		}
+	}
+	for path, version := range cp.files {
+		if _, ok := failed[path]; !ok {
+			u.release(version)
+		}
+	}
+	cp.files = failed
+	if cp.operation && len(failed) == 0 {
+		at := slices.Index(u.checkpoints, cp)
+		u.removeCheckpoints(at, at+1)
+	} else if !cp.operation {
+		// Recording starts afresh, so only changes made from now on are conflicts
+		cp.createdAt = time.Now()
+	}
+	u.sync()
+
+	return results, nil
+}
+
+// recordCheckpoints gives version, the state of its path right before a write, to every
+// checkpoint that has not seen that path change yet. Each checkpoint holds its own copy,
+// so that spilling or dropping it elsewhere leaves the checkpoint intact.
+func (u *UndoStore) recordCheckpoints(version *UndoVersion) {
+	for _, cp := range u.checkpoints {
+		if cp.operation || cp.tooLarge[version.Path] {
+			continue
+		}
+		if _, ok := cp.files[version.Path]; ok {
+			continue
+		}
+		if !u.fits(version) {
+			cp.markTooLarge(version.Path)
+			continue
+		}
+		recorded := *version
+		cp.files[version.Path] = &recorded
+		u.hold(&recorded)
+	}
+}
+
+func (cp *checkpoint) markTooLarge(path string) {
+	if cp.tooLarge == nil {
+		cp.tooLarge = make(map[string]bool)
+	}
+	cp.tooLarge[path] = true
+}
+
+// ownedCheckpoints returns the checkpoints created by origin.
+func (u *UndoStore) ownedCheckpoints(origin UndoOrigin) []*checkpoint {
+	var owned []*checkpoint
+	for _, cp := range u.checkpoints {
+		if cp.owner.owner() == origin.owner() {
+			owned = append(owned, cp)
+		}
+	}
+	return owned
+}
+
+// checkpointIndex finds the checkpoint name of origin. Failing that, it falls back to
+// one origin may act on, e.g. restored from an earlier run, and then to the only
+// checkpoint of another caller by that name, which undo_any may roll back.
+func (u *UndoStore) checkpointIndex(name string, origin UndoOrigin) (int, error) {
+	var claimable, others []int
+	for i, cp := range u.checkpoints {
+		switch {
+		case cp.name != name:
+		case cp.owner.owner() == origin.owner():
+			return i, nil
+		case cp.owner.ownedBy(origin):
+			claimable = append(claimable, i)
+		default:
+			others = append(others, i)
+		}
+	}
+
+	switch {
+	case len(claimable) > 0:
+		return claimable[0], nil
+	case len(others) == 1:
+		return others[0], nil
+	case len(others) > 1:
+		return -1, fmt.Errorf("checkpoint %q belongs to %d other sessions and none of yours", name, len(others))
+	}
+	return -1, fmt.Errorf("no checkpoint named %q", name)
+}
+
+func (u *UndoStore) removeCheckpoints(from, to int) {
+	for _, cp := range u.checkpoints[from:to] {
+		u.releaseCheckpointFiles(cp)
+	}
+	u.checkpoints = append(u.checkpoints[:from], u.checkpoints[to:]...)
+}
+
+func (u *UndoStore) releaseCheckpointFiles(cp *checkpoint) {
+	for _, version := range cp.files {
+		u.release(version)
+	}
+}
+
+// paths lists the files changed since the checkpoint, including those too large to keep.
+func (cp *checkpoint) paths() []string {
+	paths := make([]string, 0, len(cp.files)+len(cp.tooLarge))
+	for path := range cp.files {
+		paths = append(paths, path)
+	}
+	for path := range cp.tooLarge {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
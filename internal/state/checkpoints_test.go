@@ -0,0 +1,164 @@
+package state
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	//
+	"mcp-forge/api"
+)
+
+func TestCheckpointRollback(t *testing.T) {
+	u := newTestUndoStore(t, api.UndoConfig{})
+	dir := t.TempDir()
+	modified := filepath.Join(dir, "modified.txt")
+	created := filepath.Join(dir, "created.txt")
+	deleted := filepath.Join(dir, "deleted.txt")
+	untouched := filepath.Join(dir, "untouched.txt")
+	for _, path := range []string{modified, deleted, untouched} {
+		if err := os.WriteFile(path, []byte("v0"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := u.CreateCheckpoint("before", alice); err != nil {
+		t.Fatal(err)
+	}
+	writeTracked(t, u, modified, "v1", alice)
+	writeTracked(t, u, modified, "v2", alice)
+	writeTracked(t, u, created, "v1", alice)
+	if err := u.Save(deleted, alice); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(deleted); err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := u.Rollback("before", alice, false)
+	checkError(t, err, "")
+
+	actions := make(map[string]string)
+	for _, result := range results {
+		if result.Error != "" {
+			t.Errorf("rolling back %s: %s", result.Path, result.Error)
+		}
+		actions[result.Path] = result.Action
+	}
+	want := map[string]struct{ action, content string }{
+		modified: {"restored", "v0"},
+		created:  {"removed", "<missing>"},
+		deleted:  {"recreated", "v0"},
+	}
+	for path, w := range want {
+		if actions[path] != w.action {
+			t.Errorf("%s: got action %q, want %q", filepath.Base(path), actions[path], w.action)
+		}
+		if got := readTracked(t, path); got != w.content {
+			t.Errorf("%s holds %q, want %q", filepath.Base(path), got, w.content)
+		}
+	}
+	if _, ok := actions[untouched]; ok {
+		t.Errorf("rollback touched a file not changed since the checkpoint")
+	}
+
+	// Each rolled back file can still be brought forward with undo
+	_, err = u.Restore(modified, 1, alice, false)
+	checkError(t, err, "")
+	if got := readTracked(t, modified); got != "v2" {
+		t.Errorf("modified.txt holds %q after undoing the rollback, want v2", got)
+	}
+}
+
+// TestCheckpointRearm checks that a checkpoint stays after a rollback and records the
+// changes made since, and that changes from before the rollback are no conflict anymore.
+func TestCheckpointRearm(t *testing.T) {
+	u := newTestUndoStore(t, api.UndoConfig{})
+	path := filepath.Join(t.TempDir(), "file.txt")
+	if err := os.WriteFile(path, []byte("v0"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := u.CreateCheckpoint("before", alice); err != nil {
+		t.Fatal(err)
+	}
+	writeTracked(t, u, path, "v1", bob)
+	_, err := u.Rollback("before", alice, true)
+	checkError(t, err, "")
+
+	writeTracked(t, u, path, "v2", alice)
+	_, err = u.Rollback("before", alice, false)
+	checkError(t, err, "")
+	if got := readTracked(t, path); got != "v0" {
+		t.Errorf("file holds %q, want v0", got)
+	}
+	if got := len(u.Checkpoints(alice, func([]string) bool { return false })); got != 1 {
+		t.Errorf("got %d checkpoints after rollback, want 1", got)
+	}
+}
+
+// TestCheckpointOperation checks that changes registered as one operation roll back
+// together, after which the operation checkpoint goes away.
+func TestCheckpointOperation(t *testing.T) {
+	u := newTestUndoStore(t, api.UndoConfig{})
+	dir := t.TempDir()
+	changed := filepath.Join(dir, "changed.txt")
+	added := filepath.Join(dir, "added.txt")
+	for path, content := range map[string]string{changed: "after", added: "new"} {
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	name, err := u.RecordOperation("exec", []UndoFileState{
+		{Path: changed, Content: []byte("before"), Existed: true},
+		{Path: added},
+	}, alice, time.Now())
+	checkError(t, err, "")
+
+	_, err = u.Rollback(name, alice, false)
+	checkError(t, err, "")
+	if got := readTracked(t, changed); got != "before" {
+		t.Errorf("changed.txt holds %q, want before", got)
+	}
+	if got := readTracked(t, added); got != "<missing>" {
+		t.Errorf("added.txt holds %q, want it removed", got)
+	}
+
+	_, err = u.Rollback(name, alice, false)
+	checkError(t, err, "no checkpoint named")
+}
+
+// TestCheckpointNamespaces checks that names and the checkpoint limit are per caller.
+func TestCheckpointNamespaces(t *testing.T) {
+	u := newTestUndoStore(t, api.UndoConfig{})
+	path := filepath.Join(t.TempDir(), "file.txt")
+	if err := os.WriteFile(path, []byte("v0"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < maxCheckpoints; i++ {
+		checkError(t, u.CreateCheckpoint(fmt.Sprintf("cp%d", i), alice), "")
+	}
+	checkError(t, u.CreateCheckpoint("one-more", alice), "too many checkpoints")
+	checkError(t, u.CreateCheckpoint("cp0", alice), `checkpoint "cp0" already exists`)
+
+	// Neither the limit nor the names of alice get in the way of bob
+	checkError(t, u.CreateCheckpoint("cp0", bob), "")
+	writeTracked(t, u, path, "v1", bob)
+	_, err := u.Rollback("cp0", bob, false)
+	checkError(t, err, "")
+	if got := readTracked(t, path); got != "v0" {
+		t.Errorf("file holds %q, want v0", got)
+	}
+
+	// A third caller's undo_any cannot tell which of the two checkpoints is meant
+	_, err = u.CheckpointFiles("cp0", aliceElsewhere)
+	checkError(t, err, "belongs to 2 other sessions")
+	checkError(t, u.DeleteCheckpoint("cp0", bob, false), "")
+	checkError(t, u.DeleteCheckpoint("cp0", aliceElsewhere, false), "belongs to another session")
+	checkError(t, u.DeleteCheckpoint("cp0", aliceElsewhere, true), "")
+	checkError(t, u.DeleteCheckpoint("missing", alice, false), `no checkpoint named "missing"`)
+}
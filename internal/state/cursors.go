@@ -0,0 +1,94 @@
+package state
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	// cursorTTL is how long a pagination cursor stays valid after it is issued.
+	cursorTTL = 10 * time.Minute
+
+	// maxCursors bounds the number of live cursors; the oldest are dropped first.
+	maxCursors = 1000
+)
+
+// Cursor records where a paginated listing stopped. Args holds the arguments of the
+// original call so every page is produced with the same options. Position is interpreted
+// by the tool that issued the cursor: the last file a search page ended in, for example.
+// Data holds whatever else that tool needs to resume, such as the sort keys of an ls entry.
+type Cursor struct {
+	Owner     string
+	Tool      string
+	Args      map[string]interface{}
+	Position  string
+	Skip      int
+	Data      interface{}
+	CreatedAt time.Time
+}
+
+type CursorStore struct {
+	mu      sync.Mutex
+	cursors map[string]*Cursor
+}
+
+func NewCursorStore() *CursorStore {
+	return &CursorStore{
+		cursors: make(map[string]*Cursor),
+	}
+}
+
+// Put stores cursor and returns the opaque token that identifies it.
+func (c *CursorStore) Put(cursor Cursor) (string, error) {
+	raw := make([]byte, 16)
+	if _, err := rand.Read(raw); err != nil {
+		return "", fmt.Errorf("failed to generate cursor: %s", err.Error())
+	}
+	token := hex.EncodeToString(raw)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	oldestToken := ""
+	var oldest time.Time
+	for t, existing := range c.cursors {
+		if now.Sub(existing.CreatedAt) > cursorTTL {
+			delete(c.cursors, t)
+			continue
+		}
+		if oldestToken == "" || existing.CreatedAt.Before(oldest) {
+			oldestToken = t
+			oldest = existing.CreatedAt
+		}
+	}
+	if len(c.cursors) >= maxCursors && oldestToken != "" {
+		delete(c.cursors, oldestToken)
+	}
+
+	cursor.CreatedAt = now
+	c.cursors[token] = &cursor
+	return token, nil
+}
+
+// Get returns the cursor for token. Cursors are only valid for the owner and tool that
+// created them, and expire after cursorTTL. A cursor can be reused until it expires.
+func (c *CursorStore) Get(token string, owner string, tool string) (*Cursor, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	cursor, ok := c.cursors[token]
+	if !ok || cursor.Owner != owner || cursor.Tool != tool {
+		return nil, fmt.Errorf("cursor %q not found", token)
+	}
+
+	if time.Since(cursor.CreatedAt) > cursorTTL {
+		delete(c.cursors, token)
+		return nil, fmt.Errorf("cursor %q expired; run the %s again without a cursor", token, tool)
+	}
+
+	return cursor, nil
+}
@@ -0,0 +1,79 @@
+package state
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// previewTTL is how long a replace_in_files preview token stays valid.
+const previewTTL = 15 * time.Minute
+
+// ReplacePreview records what a replace_in_files preview showed, so the change can be
+// applied later exactly as previewed. Hashes maps each file that would change to the
+// SHA-256 of its content at preview time.
+type ReplacePreview struct {
+	Owner     string
+	Args      map[string]interface{}
+	Hashes    map[string]string
+	CreatedAt time.Time
+}
+
+type PreviewStore struct {
+	mu       sync.Mutex
+	previews map[string]*ReplacePreview
+}
+
+func NewPreviewStore() *PreviewStore {
+	return &PreviewStore{
+		previews: make(map[string]*ReplacePreview),
+	}
+}
+
+// Put stores a preview for owner and returns the opaque token that identifies it.
+func (p *PreviewStore) Put(owner string, args map[string]interface{}, hashes map[string]string) (string, error) {
+	raw := make([]byte, 16)
+	if _, err := rand.Read(raw); err != nil {
+		return "", fmt.Errorf("failed to generate preview token: %s", err.Error())
+	}
+	token := hex.EncodeToString(raw)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	for t, preview := range p.previews {
+		if now.Sub(preview.CreatedAt) > previewTTL {
+			delete(p.previews, t)
+		}
+	}
+
+	p.previews[token] = &ReplacePreview{
+		Owner:     owner,
+		Args:      args,
+		Hashes:    hashes,
+		CreatedAt: now,
+	}
+	return token, nil
+}
+
+// Take returns the preview for token and removes it, so every token is applied at most once.
+// Tokens are only valid for the owner that created them and expire after previewTTL.
+func (p *PreviewStore) Take(token string, owner string) (*ReplacePreview, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	preview, ok := p.previews[token]
+	if !ok || preview.Owner != owner {
+		return nil, fmt.Errorf("preview token %q not found", token)
+	}
+	delete(p.previews, token)
+
+	if time.Since(preview.CreatedAt) > previewTTL {
+		return nil, fmt.Errorf("preview token %q expired", token)
+	}
+
+	return preview, nil
+}
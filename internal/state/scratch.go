@@ -2,50 +2,169 @@ package state
 
 import (
 	"fmt"
+	"sort"
 	"sync"
+	"time"
+
+	//
+	"mcp-forge/api"
+)
+
+const (
+	// scratchDefaultMaxKeys bounds the number of keys unless configured
+	scratchDefaultMaxKeys = 1000
+
+	// scratchDefaultMaxBytes bounds the total size of keys and values unless configured
+	scratchDefaultMaxBytes = 16 * 1024 * 1024
+
+	// scratchExpireInterval is how often expired keys are removed in the background
+	scratchExpireInterval = 30 * time.Second
 )
 
+type scratchEntry struct {
+	value string
+
+	// expiresAt is zero for keys kept until deleted
+	expiresAt time.Time
+}
+
+func (e scratchEntry) expired(now time.Time) bool {
+	return !e.expiresAt.IsZero() && !now.Before(e.expiresAt)
+}
+
+// ScratchKey is a stored key with its value. TTLSeconds is the time left before the key
+// expires, or nil when it never does.
+type ScratchKey struct {
+	Key        string `json:"key"`
+	Value      string `json:"value"`
+	Size       int    `json:"size"`
+	TTLSeconds *int64 `json:"ttl_seconds,omitempty"`
+}
+
+// ScratchStore is a bounded key-value store. Keys may expire; expired keys are never
+// returned, and are removed in the background once Start is called.
 type ScratchStore struct {
-	mu   sync.RWMutex
-	data map[string]string
+	mu       sync.RWMutex
+	data     map[string]scratchEntry
+	bytes    int64
+	maxKeys  int
+	maxBytes int64
 }
 
-func NewScratchStore() *ScratchStore {
-	return &ScratchStore{
-		data: make(map[string]string),
+func NewScratchStore(config api.ScratchConfig) *ScratchStore {
+	store := &ScratchStore{
+		data:     make(map[string]scratchEntry),
+		maxKeys:  config.MaxKeys,
+		maxBytes: config.MaxBytes,
+	}
+	if store.maxKeys <= 0 {
+		store.maxKeys = scratchDefaultMaxKeys
 	}
+	if store.maxBytes <= 0 {
+		store.maxBytes = scratchDefaultMaxBytes
+	}
+	return store
+}
+
+// Start removes expired keys periodically in the background.
+func (s *ScratchStore) Start() {
+	go func() {
+		ticker := time.NewTicker(scratchExpireInterval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			s.mu.Lock()
+			s.expire(time.Now())
+			s.mu.Unlock()
+		}
+	}()
 }
 
-func (s *ScratchStore) Set(key, value string) {
+// Set stores value under key, replacing any previous value. A positive ttl makes the
+// key expire after that long. The limits on keys and bytes are enforced with an error.
+func (s *ScratchStore) Set(key, value string, ttl time.Duration) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	s.data[key] = value
+
+	now := time.Now()
+	s.expire(now)
+
+	size := int64(len(key) + len(value))
+	previous, exists := s.data[key]
+	if !exists && len(s.data) >= s.maxKeys {
+		return fmt.Errorf("scratch is full: %d keys (max %d), delete keys or set a ttl_seconds so they expire", len(s.data), s.maxKeys)
+	}
+
+	total := s.bytes + size
+	if exists {
+		total -= int64(len(key) + len(previous.value))
+	}
+	if total > s.maxBytes {
+		return fmt.Errorf("storing %d bytes under %q would bring scratch to %d bytes (max %d), delete keys or store less", size, key, total, s.maxBytes)
+	}
+
+	entry := scratchEntry{value: value}
+	if ttl > 0 {
+		entry.expiresAt = now.Add(ttl)
+	}
+	s.data[key] = entry
+	s.bytes = total
+	return nil
 }
 
 func (s *ScratchStore) Get(key string) (string, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	val, ok := s.data[key]
-	if !ok {
+	entry, ok := s.data[key]
+	if !ok || entry.expired(time.Now()) {
 		return "", fmt.Errorf("key %q not found in scratch", key)
 	}
-	return val, nil
+	return entry.value, nil
 }
 
 func (s *ScratchStore) Delete(key string) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	delete(s.data, key)
+	s.remove(key)
 }
 
-func (s *ScratchStore) List() map[string]string {
+// List returns the stored keys with their values, sorted by name.
+func (s *ScratchStore) List() []ScratchKey {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	result := make(map[string]string, len(s.data))
-	for k, v := range s.data {
-		result[k] = v
+	now := time.Now()
+	keys := make([]ScratchKey, 0, len(s.data))
+	for key, entry := range s.data {
+		if entry.expired(now) {
+			continue
+		}
+
+		info := ScratchKey{Key: key, Value: entry.value, Size: len(entry.value)}
+		if !entry.expiresAt.IsZero() {
+			// Rounded up, so that a key still listed never shows 0 seconds left
+			left := int64((entry.expiresAt.Sub(now) + time.Second - 1) / time.Second)
+			info.TTLSeconds = &left
+		}
+		keys = append(keys, info)
+	}
+
+	sort.Slice(keys, func(i, j int) bool { return keys[i].Key < keys[j].Key })
+	return keys
+}
+
+func (s *ScratchStore) expire(now time.Time) {
+	for key, entry := range s.data {
+		if entry.expired(now) {
+			s.remove(key)
+		}
+	}
+}
+
+func (s *ScratchStore) remove(key string) {
+	if entry, ok := s.data[key]; ok {
+		s.bytes -= int64(len(key) + len(entry.value))
+		delete(s.data, key)
 	}
-	return result
 }
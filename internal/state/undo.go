@@ -1,71 +1,614 @@
 package state
 
 import (
+	"container/list"
 	"fmt"
 	"os"
+	"sort"
 	"sync"
+	"time"
+
+	//
+	"mcp-forge/internal/globals"
+)
+
+const (
+	// undoDefaultMaxVersions is how many versions are kept per path unless configured
+	undoDefaultMaxVersions = 20
+
+	// undoDefaultMaxBytes bounds the content held by all versions together unless configured
+	undoDefaultMaxBytes = 256 * 1024 * 1024
+
+	// undoDefaultMaxMemoryBytes bounds the part of that content kept in memory unless configured
+	undoDefaultMaxMemoryBytes = 64 * 1024 * 1024
+
+	// undoDefaultSpillThreshold is the size above which a version goes to disk right away
+	undoDefaultSpillThreshold = 1024 * 1024
+
+	// undoDefaultMaxAge is how long a version is kept unless configured
+	undoDefaultMaxAge = 7 * 24 * time.Hour
+
+	// undoFlushInterval is how often a changed history is written to the state directory
+	undoFlushInterval = 2 * time.Second
 )
 
-type undoEntry struct {
-	Path    string
-	Content []byte
-	Existed bool
+// UndoOrigin identifies the tool call whose write saved a version.
+type UndoOrigin struct {
+	Tool    string
+	Session string
+	Subject string
+
+	// restored is set on history loaded from the state directory, whose session ended
+	// with the previous run
+	restored bool
 }
 
+// owner is who a change belongs to: the MCP session that made it. When the caller is
+// authenticated, the JWT subject must match too, so a session ID alone is not enough.
+// Restored history belongs to its JWT subject alone, and to nobody without one.
+func (o UndoOrigin) owner() string {
+	if o.restored {
+		if o.Subject == "" {
+			return "restored"
+		}
+		return "subject:" + o.Subject
+	}
+
+	owner := "session:" + o.Session
+	if o.Subject != "" {
+		owner += "\x00subject:" + o.Subject
+	}
+	return owner
+}
+
+// ownedBy reports whether caller may undo what o did without undo_any. Restored history
+// without a subject is left to undo_any.
+func (o UndoOrigin) ownedBy(caller UndoOrigin) bool {
+	if o.restored {
+		return o.Subject != "" && o.Subject == caller.Subject
+	}
+	return o.owner() == caller.owner()
+}
+
+// undoConflict reports a change that belongs to someone else than the caller.
+func undoConflict(path string, version *UndoVersion) error {
+	return fmt.Errorf("conflict: %q was changed by another session through %s at %s (version %s); only that session can undo it",
+		path, version.Origin.Tool, version.CreatedAt.Format("2006-01-02 15:04:05"), version.ID)
+}
+
+// UndoVersion is the content a file had right before one write through the tools.
+// Existed is false when the write created the file. Content is nil once the version
+// has been spilled to disk; Size is always set.
+type UndoVersion struct {
+	ID        string
+	Path      string
+	Content   []byte
+	Size      int64
+	Existed   bool
+	CreatedAt time.Time
+	Origin    UndoOrigin
+
+	// blob is the content hash under which the version is stored on disk, once it has been
+	blob string
+
+	// spilled is set when the content lives only in the blob
+	spilled bool
+}
+
+// UndoStore keeps a bounded stack of versions per path, newest last. When a limit is
+// exceeded the versions of the least recently used paths go first: to disk when too
+// much is held in memory, dropped when too much is held overall. Undone states go to a
+// redo stack, which is cleared as soon as the path is written again.
 type UndoStore struct {
-	mu      sync.Mutex
-	entries map[string]undoEntry
+	appCtx *globals.ApplicationContext
+
+	mu             sync.Mutex
+	entries        map[string][]*UndoVersion
+	redo           map[string][]*UndoVersion
+	checkpoints    []*checkpoint
+	maxVersions    int
+	maxBytes       int64
+	maxMemoryBytes int64
+	spillThreshold int64
+	maxAge         time.Duration
+	bytes          int64
+	memoryBytes    int64
+	counter        int
+
+	// redoOwners records who filled the redo stack of each path, the only one allowed to redo
+	redoOwners map[string]UndoOrigin
+
+	// lru orders the paths with undo or redo state, least recently saved or restored
+	// first, for eviction. lruAt finds the element of a path
+	lru   *list.List
+	lruAt map[string]*list.Element
+
+	// stateDir is where the history is persisted, empty to keep it in memory only.
+	// Spilled contents go to its blob directory, or to a temporary one without it
+	stateDir string
+	spillDir string
+	blobs    map[string]bool
+
+	// dirty is set when the history changed since it was last flushed
+	dirty     bool
+	flushMu   sync.Mutex
+	done      chan struct{}
+	stopped   chan struct{}
+	closeOnce sync.Once
 }
 
-func NewUndoStore() *UndoStore {
-	return &UndoStore{
-		entries: make(map[string]undoEntry),
+// NewUndoStore creates the undo store from the undo configuration section, loading the
+// persisted history when a state directory is configured.
+func NewUndoStore(appCtx *globals.ApplicationContext) *UndoStore {
+	config := appCtx.Config.Undo
+	store := &UndoStore{
+		appCtx:         appCtx,
+		entries:        make(map[string][]*UndoVersion),
+		redo:           make(map[string][]*UndoVersion),
+		redoOwners:     make(map[string]UndoOrigin),
+		maxVersions:    config.MaxVersionsPerPath,
+		maxBytes:       config.MaxBytes,
+		maxMemoryBytes: config.MaxMemoryBytes,
+		spillThreshold: config.SpillThreshold,
+		maxAge:         config.MaxAge,
+		lru:            list.New(),
+		lruAt:          make(map[string]*list.Element),
+		stateDir:       config.StateDir,
+		blobs:          make(map[string]bool),
+	}
+	if store.maxVersions <= 0 {
+		store.maxVersions = undoDefaultMaxVersions
+	}
+	if store.maxBytes <= 0 {
+		store.maxBytes = undoDefaultMaxBytes
+	}
+	if store.maxMemoryBytes <= 0 {
+		store.maxMemoryBytes = undoDefaultMaxMemoryBytes
+	}
+	if store.spillThreshold <= 0 {
+		store.spillThreshold = undoDefaultSpillThreshold
+	}
+	if store.maxAge <= 0 {
+		store.maxAge = undoDefaultMaxAge
 	}
+	if store.stateDir != "" {
+		store.spillDir = store.blobDir()
+	}
+
+	store.load()
+	return store
 }
 
-func (u *UndoStore) Save(path string) error {
+// Start flushes changes to the history in the background, so that writes through the
+// tools do not wait for the history to be persisted.
+func (u *UndoStore) Start() {
+	u.done = make(chan struct{})
+	u.stopped = make(chan struct{})
+
+	go func() {
+		defer close(u.stopped)
+
+		ticker := time.NewTicker(undoFlushInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				u.flush()
+			case <-u.done:
+				u.flush()
+				return
+			}
+		}
+	}()
+}
+
+// Close stops the background flush and writes out the changes still pending. Without a
+// state directory, the contents spilled to the temporary directory are removed.
+func (u *UndoStore) Close() {
+	u.closeOnce.Do(func() {
+		if u.done != nil {
+			close(u.done)
+			<-u.stopped
+		} else {
+			u.flush()
+		}
+
+		u.mu.Lock()
+		defer u.mu.Unlock()
+		if u.stateDir == "" && u.spillDir != "" {
+			if err := os.RemoveAll(u.spillDir); err != nil {
+				u.appCtx.Logger.Warn("undo: failed removing spilled contents", "path", u.spillDir, "error", err.Error())
+			}
+		}
+	})
+}
+
+// Save pushes the current content of path as a new version and clears its redo stack.
+// origin describes the write about to happen.
+func (u *UndoStore) Save(path string, origin UndoOrigin) error {
 	u.mu.Lock()
 	defer u.mu.Unlock()
 
-	entry := undoEntry{Path: path}
+	version, err := u.capture(path, origin)
+	if err != nil {
+		return fmt.Errorf("failed to save undo state for %q: %s", path, err.Error())
+	}
+
+	u.touch(path)
+	u.clearRedo(path)
+	u.recordCheckpoints(version)
+	err = u.push(path, version)
+	u.expire()
+	u.sync()
+	return err
+}
+
+// capture reads the current state of path into a new version.
+func (u *UndoStore) capture(path string, origin UndoOrigin) (*UndoVersion, error) {
+	version := &UndoVersion{Path: path, CreatedAt: time.Now(), Origin: origin}
 
 	content, err := os.ReadFile(path)
 	if err != nil {
-		if os.IsNotExist(err) {
-			entry.Existed = false
-		} else {
-			return fmt.Errorf("failed to save undo state for %q: %s", path, err.Error())
+		if !os.IsNotExist(err) {
+			return nil, err
 		}
+		version.Existed = false
 	} else {
-		entry.Existed = true
-		entry.Content = content
+		version.Existed = true
+		version.Content = content
+		version.Size = int64(len(content))
+	}
+
+	u.counter++
+	version.ID = fmt.Sprintf("v%d", u.counter)
+	return version, nil
+}
+
+// push appends version to the undo stack of path, applying the limits. A version too
+// large to keep is left out with an error.
+func (u *UndoStore) push(path string, version *UndoVersion) error {
+	if !u.fits(version) {
+		u.forgetUnused(path)
+		return fmt.Errorf("%q is too large to keep in the undo history (%d bytes, max_bytes %d)", path, version.Size, u.maxBytes)
 	}
 
-	u.entries[path] = entry
+	u.entries[path] = append(u.entries[path], version)
+	u.hold(version)
+
+	if versions := u.entries[path]; len(versions) > u.maxVersions {
+		u.drop(path, len(versions)-u.maxVersions)
+	}
+	u.enforceLimits()
 	return nil
 }
 
-func (u *UndoStore) Restore(path string) error {
+// Snapshot returns the newest content saved for path by origin without restoring it, or
+// by anyone when override is set. existed is false when the file did not exist at save
+// time, i.e. it was created afterwards.
+func (u *UndoStore) Snapshot(path string, origin UndoOrigin, override bool) (content []byte, existed bool, err error) {
 	u.mu.Lock()
 	defer u.mu.Unlock()
 
-	entry, ok := u.entries[path]
-	if !ok {
-		return fmt.Errorf("no undo history for %q", path)
+	versions := visible(u.entries[path], origin, override)
+	if len(versions) == 0 {
+		return nil, false, fmt.Errorf("no undo history for %q", path)
 	}
 
-	if !entry.Existed {
-		err := os.Remove(path)
-		if err != nil && !os.IsNotExist(err) {
-			return fmt.Errorf("failed to undo (remove) %q: %s", path, err.Error())
+	latest := versions[len(versions)-1]
+	content, err = u.content(latest)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to read undo snapshot of %q: %s", path, err.Error())
+	}
+	return content, latest.Existed, nil
+}
+
+// Versions lists the versions of path saved by origin, or by anyone when override is
+// set, oldest first, without their content.
+func (u *UndoStore) Versions(path string, origin UndoOrigin, override bool) []UndoVersion {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	return metadata(visible(u.entries[path], origin, override))
+}
+
+// Paths lists the paths with undo history saved by origin, or by anyone when override
+// reports true for the path, sorted.
+func (u *UndoStore) Paths(origin UndoOrigin, override func(path string) bool) []string {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	paths := make([]string, 0, len(u.entries))
+	for path, versions := range u.entries {
+		if len(visible(versions, origin, override(path))) > 0 {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// VersionContent returns the content saved in the version id of path. Versions saved by
+// someone else than origin are not found unless override is set.
+func (u *UndoStore) VersionContent(path, id string, origin UndoOrigin, override bool) (content []byte, existed bool, err error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	for _, version := range visible(u.entries[path], origin, override) {
+		if version.ID == id {
+			content, err = u.content(version)
+			if err != nil {
+				return nil, false, fmt.Errorf("failed to read undo version %q of %q: %s", id, path, err.Error())
+			}
+			return content, version.Existed, nil
+		}
+	}
+	return nil, false, fmt.Errorf("no undo version %q for %q", id, path)
+}
+
+// Restore goes back steps versions: steps=1 restores the newest version. The restored
+// version and every newer one are removed from the history. Every change undone must
+// belong to origin, unless override is set.
+func (u *UndoStore) Restore(path string, steps int, origin UndoOrigin, override bool) (*UndoVersion, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	versions := u.entries[path]
+	if len(versions) == 0 {
+		return nil, fmt.Errorf("no undo history for %q", path)
+	}
+	if steps < 1 || steps > len(versions) {
+		return nil, fmt.Errorf("cannot undo %d steps for %q: %d versions available", steps, path, len(versions))
+	}
+
+	return u.restore(path, len(versions)-steps, origin, override)
+}
+
+// RestoreVersion restores the version with the given ID. Newer versions are removed
+// from the history along with it.
+func (u *UndoStore) RestoreVersion(path, id string, origin UndoOrigin, override bool) (*UndoVersion, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	for i, version := range u.entries[path] {
+		if version.ID == id {
+			return u.restore(path, i, origin, override)
 		}
+	}
+	return nil, fmt.Errorf("no undo version %q for %q", id, path)
+}
+
+func (u *UndoStore) restore(path string, index int, origin UndoOrigin, override bool) (*UndoVersion, error) {
+	versions := u.entries[path]
+	version := versions[index]
+
+	// Each version was saved by the write it undoes, newest last
+	if !override {
+		for i := len(versions) - 1; i >= index; i-- {
+			if !versions[i].Origin.ownedBy(origin) {
+				return nil, undoConflict(path, versions[i])
+			}
+		}
+	}
+
+	current, err := u.capture(path, origin)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %q before undo: %s", path, err.Error())
+	}
+
+	if err := u.writeVersion(version); err != nil {
+		return nil, fmt.Errorf("failed to undo %q: %s", path, err.Error())
+	}
+
+	// Redo replays forward one step at a time: the state before this undo lies at the
+	// bottom, and the version right after the restored one on top. States undone by
+	// someone else cannot be redone past this undo anyway
+	if owner, ok := u.redoOwners[path]; !ok || !owner.ownedBy(origin) {
+		u.clearRedo(path)
+	}
+	if u.fits(current) {
+		redo := append(u.redo[path], current)
+		for i := len(versions) - 1; i > index; i-- {
+			redo = append(redo, versions[i])
+		}
+		u.redo[path] = redo
+		u.redoOwners[path] = origin
+		u.hold(current)
 	} else {
-		err := os.WriteFile(path, entry.Content, 0644)
-		if err != nil {
-			return fmt.Errorf("failed to undo (restore) %q: %s", path, err.Error())
+		// Redo could never get back to a state too large to keep
+		u.appCtx.Logger.Warn("undo: state before undo is too large to keep, redo is unavailable", "path", path, "size", current.Size)
+		u.clearRedo(path)
+		for _, newer := range versions[index+1:] {
+			u.release(newer)
 		}
 	}
+	u.release(version)
+	u.recordCheckpoints(current)
+	u.touch(path)
 
-	delete(u.entries, path)
-	return nil
+	u.entries[path] = versions[:index]
+	if index == 0 {
+		delete(u.entries, path)
+	}
+
+	if redo := u.redo[path]; len(redo) > u.maxVersions {
+		u.dropRedo(path, len(redo)-u.maxVersions)
+	}
+	u.forgetUnused(path)
+	u.enforceLimits()
+	u.sync()
+
+	return version, nil
+}
+
+// Redo reapplies the state undone most recently on path. The state it replaces becomes
+// a new undo version, so undo and redo can alternate. Only whoever undid can redo,
+// unless override is set.
+func (u *UndoStore) Redo(path string, origin UndoOrigin, override bool) (*UndoVersion, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	redo := u.redo[path]
+	if len(redo) == 0 {
+		return nil, fmt.Errorf("nothing to redo for %q", path)
+	}
+	version := redo[len(redo)-1]
+
+	if owner := u.redoOwners[path]; !override && !owner.ownedBy(origin) {
+		return nil, fmt.Errorf("conflict: the changes to redo on %q were undone by another session; only that session can redo them", path)
+	}
+
+	current, err := u.capture(path, origin)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %q before redo: %s", path, err.Error())
+	}
+
+	if err := u.writeVersion(version); err != nil {
+		return nil, fmt.Errorf("failed to redo %q: %s", path, err.Error())
+	}
+
+	u.redo[path] = redo[:len(redo)-1]
+	if len(u.redo[path]) == 0 {
+		delete(u.redo, path)
+		delete(u.redoOwners, path)
+	}
+	u.release(version)
+	u.recordCheckpoints(current)
+	u.touch(path)
+	if err := u.push(path, current); err != nil {
+		u.appCtx.Logger.Warn("undo: redo cannot be undone", "error", err.Error())
+	}
+	u.sync()
+
+	return version, nil
+}
+
+// RedoVersions lists the states redo would reapply for path, next one last, without
+// content. The list is empty for anyone but whoever undid, unless override is set.
+func (u *UndoStore) RedoVersions(path string, origin UndoOrigin, override bool) []UndoVersion {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if owner := u.redoOwners[path]; !override && !owner.ownedBy(origin) {
+		return []UndoVersion{}
+	}
+	return metadata(u.redo[path])
+}
+
+// visible keeps the versions saved by origin, or all of them when override is set.
+func visible(versions []*UndoVersion, origin UndoOrigin, override bool) []*UndoVersion {
+	if override {
+		return versions
+	}
+
+	owned := make([]*UndoVersion, 0, len(versions))
+	for _, version := range versions {
+		if version.Origin.ownedBy(origin) {
+			owned = append(owned, version)
+		}
+	}
+	return owned
+}
+
+// metadata copies versions without their content.
+func metadata(versions []*UndoVersion) []UndoVersion {
+	metas := make([]UndoVersion, 0, len(versions))
+	for _, version := range versions {
+		meta := *version
+		meta.Content = nil
+		metas = append(metas, meta)
+	}
+	return metas
+}
+
+// writeVersion puts the content of version back on disk, removing the file when it
+// did not exist at that point.
+func (u *UndoStore) writeVersion(version *UndoVersion) error {
+	if !version.Existed {
+		err := os.Remove(version.Path)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+
+	content, err := u.content(version)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(version.Path, content, 0644)
+}
+
+func (u *UndoStore) clearRedo(path string) {
+	for _, version := range u.redo[path] {
+		u.release(version)
+	}
+	delete(u.redo, path)
+	delete(u.redoOwners, path)
+}
+
+// dropRedo removes the n states at the bottom of the redo stack of path, the furthest
+// away from the current state.
+func (u *UndoStore) dropRedo(path string, n int) {
+	redo := u.redo[path]
+	for _, dropped := range redo[:n] {
+		u.release(dropped)
+	}
+	if n >= len(redo) {
+		delete(u.redo, path)
+		delete(u.redoOwners, path)
+		u.forgetUnused(path)
+		return
+	}
+	u.redo[path] = append([]*UndoVersion(nil), redo[n:]...)
+}
+
+// drop removes the n oldest versions of path.
+func (u *UndoStore) drop(path string, n int) {
+	versions := u.entries[path]
+	for _, dropped := range versions[:n] {
+		u.release(dropped)
+	}
+	if n >= len(versions) {
+		delete(u.entries, path)
+		u.forgetUnused(path)
+		return
+	}
+	u.entries[path] = append([]*UndoVersion(nil), versions[n:]...)
+}
+
+// expire drops the versions and checkpoints older than the configured maximum age.
+func (u *UndoStore) expire() {
+	cutoff := time.Now().Add(-u.maxAge)
+
+	for path, versions := range u.entries {
+		n := 0
+		for n < len(versions) && versions[n].CreatedAt.Before(cutoff) {
+			n++
+		}
+		if n > 0 {
+			u.drop(path, n)
+		}
+	}
+
+	// Redo states are replayed in order, so everything beyond an expired one goes with it
+	for path, redo := range u.redo {
+		n := 0
+		for i, version := range redo {
+			if version.CreatedAt.Before(cutoff) {
+				n = i + 1
+			}
+		}
+		if n > 0 {
+			u.dropRedo(path, n)
+		}
+	}
+
+	for i := 0; i < len(u.checkpoints); {
+		if u.checkpoints[i].createdAt.Before(cutoff) {
+			u.removeCheckpoints(i, i+1)
+			continue
+		}
+		i++
+	}
 }
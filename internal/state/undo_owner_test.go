@@ -0,0 +1,217 @@
+package state
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	//
+	"mcp-forge/api"
+)
+
+var (
+	alice          = UndoOrigin{Tool: "write_file", Session: "s1", Subject: "alice"}
+	aliceElsewhere = UndoOrigin{Tool: "write_file", Session: "s2", Subject: "alice"}
+	bob            = UndoOrigin{Tool: "write_file", Session: "s3", Subject: "bob"}
+	sessionOnly    = UndoOrigin{Tool: "write_file", Session: "s1"}
+)
+
+// undoOwnerActions set up a change by owner and act on it as caller. They return the
+// content of the file once the action succeeded, and as long as it was refused.
+var undoOwnerActions = map[string]func(t *testing.T, u *UndoStore, path string, owner, caller UndoOrigin, override bool) (allowed, refused string){
+	"undo": func(t *testing.T, u *UndoStore, path string, owner, caller UndoOrigin, override bool) (string, string) {
+		writeTracked(t, u, path, "v1", owner)
+		_, _ = u.Restore(path, 1, caller, override)
+		return "v0", "v1"
+	},
+	"redo": func(t *testing.T, u *UndoStore, path string, owner, caller UndoOrigin, override bool) (string, string) {
+		writeTracked(t, u, path, "v1", owner)
+		if _, err := u.Restore(path, 1, owner, false); err != nil {
+			t.Fatal(err)
+		}
+		_, _ = u.Redo(path, caller, override)
+		return "v1", "v0"
+	},
+	"rollback": func(t *testing.T, u *UndoStore, path string, owner, caller UndoOrigin, override bool) (string, string) {
+		if err := u.CreateCheckpoint("before", owner); err != nil {
+			t.Fatal(err)
+		}
+		writeTracked(t, u, path, "v1", owner)
+		_, _ = u.Rollback("before", caller, override)
+		return "v0", "v1"
+	},
+}
+
+func TestUndoOwnership(t *testing.T) {
+	tests := []struct {
+		name     string
+		owner    UndoOrigin
+		caller   UndoOrigin
+		override bool
+		allowed  bool
+	}{
+		{name: "same session and subject", owner: alice, caller: alice, allowed: true},
+		{name: "same session without JWT", owner: sessionOnly, caller: sessionOnly, allowed: true},
+		{name: "same subject in another session", owner: alice, caller: aliceElsewhere},
+		{name: "another subject", owner: alice, caller: bob},
+		{name: "same session without the subject", owner: alice, caller: sessionOnly},
+		{name: "undo_any", owner: alice, caller: bob, override: true, allowed: true},
+	}
+
+	for _, tt := range tests {
+		for action, run := range undoOwnerActions {
+			t.Run(tt.name+"/"+action, func(t *testing.T) {
+				u := newTestUndoStore(t, api.UndoConfig{})
+				path := filepath.Join(t.TempDir(), "file.txt")
+				if err := os.WriteFile(path, []byte("v0"), 0644); err != nil {
+					t.Fatal(err)
+				}
+
+				allowed, refused := run(t, u, path, tt.owner, tt.caller, tt.override)
+				want := refused
+				if tt.allowed {
+					want = allowed
+				}
+				if got := readTracked(t, path); got != want {
+					t.Errorf("file holds %q, want %q", got, want)
+				}
+			})
+		}
+	}
+}
+
+// TestUndoConflict checks that a change by someone else cannot be undone as a side
+// effect of undoing one's own earlier change.
+func TestUndoConflict(t *testing.T) {
+	u := newTestUndoStore(t, api.UndoConfig{})
+	path := filepath.Join(t.TempDir(), "file.txt")
+	if err := os.WriteFile(path, []byte("v0"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := u.CreateCheckpoint("before", alice); err != nil {
+		t.Fatal(err)
+	}
+	writeTracked(t, u, path, "v1", alice)
+	writeTracked(t, u, path, "v2", bob)
+
+	_, err := u.Restore(path, 2, alice, false)
+	checkError(t, err, "conflict")
+	_, err = u.Rollback("before", alice, false)
+	checkError(t, err, "conflict")
+	if got := readTracked(t, path); got != "v2" {
+		t.Fatalf("file holds %q after refused undos, want v2", got)
+	}
+
+	// Undoing its own change stays possible for bob
+	_, err = u.Restore(path, 1, bob, false)
+	checkError(t, err, "")
+	if got := readTracked(t, path); got != "v1" {
+		t.Errorf("file holds %q, want v1", got)
+	}
+}
+
+func TestUndoHistoryScopedToOwner(t *testing.T) {
+	u := newTestUndoStore(t, api.UndoConfig{})
+	path := filepath.Join(t.TempDir(), "file.txt")
+	writeTracked(t, u, path, "v0", alice)
+	writeTracked(t, u, path, "v1", bob)
+
+	tests := []struct {
+		name     string
+		caller   UndoOrigin
+		override bool
+		versions int
+		snapshot string
+	}{
+		{name: "first writer", caller: alice, versions: 1, snapshot: "<missing>"},
+		{name: "second writer", caller: bob, versions: 1, snapshot: "v0"},
+		{name: "same subject in another session", caller: aliceElsewhere, versions: 0},
+		{name: "undo_any", caller: aliceElsewhere, override: true, versions: 2, snapshot: "v0"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := len(u.Versions(path, tt.caller, tt.override)); got != tt.versions {
+				t.Errorf("got %d versions, want %d", got, tt.versions)
+			}
+
+			override := func(string) bool { return tt.override }
+			if got := len(u.Paths(tt.caller, override)); got != min(tt.versions, 1) {
+				t.Errorf("got %d paths, want %d", got, min(tt.versions, 1))
+			}
+
+			content, existed, err := u.Snapshot(path, tt.caller, tt.override)
+			if tt.versions == 0 {
+				if err == nil {
+					t.Fatal("got a snapshot of changes made by someone else")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := string(content)
+			if !existed {
+				got = "<missing>"
+			}
+			if got != tt.snapshot {
+				t.Errorf("got snapshot %q, want %q", got, tt.snapshot)
+			}
+		})
+	}
+}
+
+// TestUndoOwnershipAfterRestart reloads a persisted history, whose sessions are gone:
+// it stays with its JWT subject, and history without one is left to undo_any.
+func TestUndoOwnershipAfterRestart(t *testing.T) {
+	config := api.UndoConfig{StateDir: t.TempDir()}
+	dir := t.TempDir()
+	withSubject := filepath.Join(dir, "subject.txt")
+	withoutSubject := filepath.Join(dir, "session.txt")
+	checkpointed := filepath.Join(dir, "checkpointed.txt")
+	for _, path := range []string{withSubject, withoutSubject, checkpointed} {
+		if err := os.WriteFile(path, []byte("v0"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	before := newTestUndoStore(t, config)
+	writeTracked(t, before, withSubject, "v1", alice)
+	writeTracked(t, before, withoutSubject, "v1", sessionOnly)
+	if err := before.CreateCheckpoint("before", alice); err != nil {
+		t.Fatal(err)
+	}
+	writeTracked(t, before, checkpointed, "v1", alice)
+	before.Close()
+
+	after := newTestUndoStore(t, config)
+	aliceAgain := UndoOrigin{Tool: "undo", Session: "s9", Subject: "alice"}
+	sessionAgain := UndoOrigin{Tool: "undo", Session: "s9"}
+
+	if got := len(after.Versions(withSubject, aliceAgain, false)); got != 1 {
+		t.Fatalf("got %d restored versions for the subject, want 1", got)
+	}
+	_, err := after.Restore(withSubject, 1, aliceAgain, false)
+	checkError(t, err, "")
+	if got := readTracked(t, withSubject); got != "v0" {
+		t.Errorf("file holds %q after undo, want v0", got)
+	}
+
+	_, err = after.Rollback("before", aliceAgain, false)
+	checkError(t, err, "")
+	if got := readTracked(t, checkpointed); got != "v0" {
+		t.Errorf("file holds %q after rollback, want v0", got)
+	}
+
+	// Even the same session ID does not prove it is the same client after a restart
+	if got := len(after.Versions(withoutSubject, sessionOnly, false)); got != 0 {
+		t.Fatalf("got %d restored versions without a subject, want 0", got)
+	}
+	_, err = after.Restore(withoutSubject, 1, sessionAgain, false)
+	checkError(t, err, "conflict")
+	_, err = after.Restore(withoutSubject, 1, sessionAgain, true)
+	checkError(t, err, "")
+	if got := readTracked(t, withoutSubject); got != "v0" {
+		t.Errorf("file holds %q after undo_any, want v0", got)
+	}
+}
@@ -0,0 +1,360 @@
+package state
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"time"
+
+	//
+	"mcp-forge/internal/fileutil"
+)
+
+// undoPersistVersion identifies the layout of the persisted history. History written in
+// any other layout is ignored on load.
+const undoPersistVersion = 2
+
+// The history is a single metadata file next to a directory of content-addressed blobs,
+// so identical contents saved for several versions or paths are stored once.
+type persistedUndo struct {
+	Version     int
+	Counter     int
+	Entries     map[string][]persistedUndoVersion
+	Redo        map[string][]persistedUndoVersion
+	RedoOrigins map[string]UndoOrigin
+	Checkpoints []persistedCheckpoint
+}
+
+type persistedUndoVersion struct {
+	ID        string
+	Path      string
+	Size      int64
+	Blob      string
+	Existed   bool
+	CreatedAt time.Time
+	Origin    UndoOrigin
+}
+
+type persistedCheckpoint struct {
+	Name      string
+	CreatedAt time.Time
+	Owner     UndoOrigin
+	Operation bool
+	Files     map[string]persistedUndoVersion
+	TooLarge  []string
+}
+
+func (u *UndoStore) historyFile() string {
+	return filepath.Join(u.stateDir, "undo", "history.gob")
+}
+
+func (u *UndoStore) blobDir() string {
+	return filepath.Join(u.stateDir, "undo", "blobs")
+}
+
+// load seeds the store from the persisted history. Versions whose content is missing are
+// skipped, and the configured limits apply to what remains.
+func (u *UndoStore) load() {
+	if u.stateDir == "" {
+		return
+	}
+
+	data, err := os.ReadFile(u.historyFile())
+	if err != nil {
+		if !os.IsNotExist(err) {
+			u.appCtx.Logger.Warn("undo: ignoring unreadable persisted history", "error", err.Error())
+		}
+		return
+	}
+
+	var persisted persistedUndo
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&persisted); err != nil {
+		u.appCtx.Logger.Warn("undo: ignoring unreadable persisted history", "error", err.Error())
+		return
+	}
+	if persisted.Version != undoPersistVersion {
+		u.appCtx.Logger.Warn("undo: ignoring persisted history with unsupported format version",
+			"version", persisted.Version, "supported", undoPersistVersion)
+		return
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if entries, err := os.ReadDir(u.blobDir()); err == nil {
+		for _, entry := range entries {
+			u.blobs[entry.Name()] = true
+		}
+	}
+
+	// Sessions do not outlive a restart, so the history now belongs to JWT subjects only
+	restoredOrigin := func(origin UndoOrigin) UndoOrigin {
+		origin.restored = true
+		return origin
+	}
+
+	// Contents stay on disk until a version is restored, as if they had been spilled
+	missing := 0
+	restore := func(p persistedUndoVersion) *UndoVersion {
+		version := &UndoVersion{ID: p.ID, Path: p.Path, Existed: p.Existed, CreatedAt: p.CreatedAt, Origin: restoredOrigin(p.Origin)}
+		if !p.Existed {
+			return version
+		}
+		if !u.blobs[p.Blob] {
+			missing++
+			return nil
+		}
+		// max_bytes may have been lowered below the size of this version since
+		if p.Size > u.maxBytes {
+			return nil
+		}
+		version.Size = p.Size
+		version.blob = p.Blob
+		version.spilled = true
+		return version
+	}
+	restoreAll := func(stacks map[string][]persistedUndoVersion, into map[string][]*UndoVersion) {
+		for path, stack := range stacks {
+			for _, p := range stack {
+				if version := restore(p); version != nil {
+					into[path] = append(into[path], version)
+					u.hold(version)
+				}
+			}
+		}
+	}
+
+	u.counter = persisted.Counter
+	restoreAll(persisted.Entries, u.entries)
+	restoreAll(persisted.Redo, u.redo)
+	for path, owner := range persisted.RedoOrigins {
+		if len(u.redo[path]) > 0 {
+			u.redoOwners[path] = restoredOrigin(owner)
+		}
+	}
+	for _, p := range persisted.Checkpoints {
+		cp := &checkpoint{name: p.Name, createdAt: p.CreatedAt, owner: restoredOrigin(p.Owner), operation: p.Operation, files: make(map[string]*UndoVersion)}
+		for _, path := range p.TooLarge {
+			cp.markTooLarge(path)
+		}
+		for path, file := range p.Files {
+			if version := restore(file); version != nil {
+				cp.files[path] = version
+				u.hold(version)
+			}
+		}
+		u.checkpoints = append(u.checkpoints, cp)
+	}
+	if missing > 0 {
+		u.appCtx.Logger.Warn("undo: skipped persisted versions with missing content", "count", missing)
+	}
+
+	// Paths rank for eviction by when they last changed
+	paths := slices.Collect(maps.Keys(u.entries))
+	for path := range u.redo {
+		if _, ok := u.entries[path]; !ok {
+			paths = append(paths, path)
+		}
+	}
+	newest := func(path string) time.Time {
+		var latest time.Time
+		for _, version := range slices.Concat(u.entries[path], u.redo[path]) {
+			if version.CreatedAt.After(latest) {
+				latest = version.CreatedAt
+			}
+		}
+		return latest
+	}
+	sort.Slice(paths, func(i, j int) bool { return newest(paths[i]).Before(newest(paths[j])) })
+	for _, path := range paths {
+		u.touch(path)
+	}
+
+	// The limits may have been lowered since the history was written
+	for path, versions := range u.entries {
+		if len(versions) > u.maxVersions {
+			u.drop(path, len(versions)-u.maxVersions)
+		}
+	}
+	for path, redo := range u.redo {
+		if len(redo) > u.maxVersions {
+			u.dropRedo(path, len(redo)-u.maxVersions)
+		}
+	}
+	u.expire()
+	u.enforceLimits()
+
+	// The first flush writes back what the limits left and removes stale blobs
+	u.dirty = true
+
+	u.appCtx.Logger.Info("undo: loaded persisted history", "paths", len(u.entries), "checkpoints", len(u.checkpoints))
+}
+
+// flush writes the history to the state directory when it changed since the last flush.
+// The state is copied under the lock, then written without it: new blobs first, then the
+// metadata file, and finally blobs no longer referenced are removed. Without a state
+// directory only the spilled contents no version refers to anymore are removed.
+// Failures are logged and retried on the next flush, the in-memory history stays
+// authoritative.
+func (u *UndoStore) flush() {
+	u.flushMu.Lock()
+	defer u.flushMu.Unlock()
+
+	u.mu.Lock()
+	if !u.dirty {
+		u.mu.Unlock()
+		return
+	}
+	u.dirty = false
+
+	if u.stateDir == "" {
+		u.collectBlobs(u.referencedBlobs())
+		u.mu.Unlock()
+		return
+	}
+	persisted, pending, written := u.snapshotHistory()
+	u.mu.Unlock()
+
+	err := u.writeHistory(persisted, pending)
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if err != nil {
+		u.appCtx.Logger.Error("undo: failed persisting history", "error", err.Error())
+		u.dirty = true
+		return
+	}
+	for blob := range pending {
+		u.blobs[blob] = true
+	}
+
+	// Blobs of the history just written stay until the next flush replaces it
+	referenced := u.referencedBlobs()
+	for blob := range written {
+		referenced[blob] = true
+	}
+	u.collectBlobs(referenced)
+}
+
+// snapshotHistory copies the metadata of every version, checkpoint and redo state. It
+// returns the contents still to be written as blobs, and every blob the copy refers to.
+// Callers hold the lock.
+func (u *UndoStore) snapshotHistory() (persisted persistedUndo, pending map[string][]byte, written map[string]bool) {
+	pending = make(map[string][]byte)
+	written = make(map[string]bool)
+	record := func(version *UndoVersion) persistedUndoVersion {
+		p := persistedUndoVersion{ID: version.ID, Path: version.Path, Size: version.Size, Existed: version.Existed, CreatedAt: version.CreatedAt, Origin: version.Origin}
+		if !version.Existed {
+			return p
+		}
+
+		if version.blob == "" {
+			sum := sha256.Sum256(version.Content)
+			version.blob = hex.EncodeToString(sum[:])
+		}
+		p.Blob = version.blob
+		written[version.blob] = true
+
+		if !u.blobs[version.blob] && !version.spilled {
+			pending[version.blob] = version.Content
+		}
+		return p
+	}
+	recordAll := func(stacks map[string][]*UndoVersion) map[string][]persistedUndoVersion {
+		out := make(map[string][]persistedUndoVersion, len(stacks))
+		for path, stack := range stacks {
+			for _, version := range stack {
+				out[path] = append(out[path], record(version))
+			}
+		}
+		return out
+	}
+
+	persisted = persistedUndo{
+		Version:     undoPersistVersion,
+		Counter:     u.counter,
+		Entries:     recordAll(u.entries),
+		Redo:        recordAll(u.redo),
+		RedoOrigins: maps.Clone(u.redoOwners),
+	}
+	for _, cp := range u.checkpoints {
+		files := make(map[string]persistedUndoVersion, len(cp.files))
+		for path, version := range cp.files {
+			files[path] = record(version)
+		}
+		persisted.Checkpoints = append(persisted.Checkpoints, persistedCheckpoint{
+			Name:      cp.name,
+			CreatedAt: cp.createdAt,
+			Owner:     cp.owner,
+			Operation: cp.operation,
+			Files:     files,
+			TooLarge:  slices.Sorted(maps.Keys(cp.tooLarge)),
+		})
+	}
+	return persisted, pending, written
+}
+
+// writeHistory writes the pending blobs, then the metadata referring to them, so that
+// the metadata on disk never points at a blob that failed to write.
+func (u *UndoStore) writeHistory(persisted persistedUndo, pending map[string][]byte) error {
+	for blob, content := range pending {
+		if err := fileutil.WriteFileAtomic(filepath.Join(u.blobDir(), blob), content); err != nil {
+			return fmt.Errorf("failed writing content: %s", err.Error())
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(persisted); err != nil {
+		return fmt.Errorf("failed encoding history: %s", err.Error())
+	}
+	return fileutil.WriteFileAtomic(u.historyFile(), buf.Bytes())
+}
+
+// referencedBlobs returns the blobs some version still refers to. Callers hold the lock.
+func (u *UndoStore) referencedBlobs() map[string]bool {
+	referenced := make(map[string]bool)
+	mark := func(version *UndoVersion) {
+		if version.blob != "" {
+			referenced[version.blob] = true
+		}
+	}
+	for _, versions := range u.entries {
+		for _, version := range versions {
+			mark(version)
+		}
+	}
+	for _, redo := range u.redo {
+		for _, version := range redo {
+			mark(version)
+		}
+	}
+	for _, cp := range u.checkpoints {
+		for _, version := range cp.files {
+			mark(version)
+		}
+	}
+	return referenced
+}
+
+// collectBlobs removes the blobs on disk no version refers to anymore, including ones
+// left over from an earlier run. Callers hold the lock.
+func (u *UndoStore) collectBlobs(referenced map[string]bool) {
+	for name := range u.blobs {
+		if referenced[name] {
+			continue
+		}
+		if err := os.Remove(filepath.Join(u.spillDir, name)); err != nil && !os.IsNotExist(err) {
+			u.appCtx.Logger.Warn("undo: failed removing unreferenced content", "blob", name, "error", err.Error())
+			continue
+		}
+		delete(u.blobs, name)
+	}
+}
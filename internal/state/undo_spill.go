@@ -0,0 +1,239 @@
+package state
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"sort"
+
+	//
+	"mcp-forge/internal/fileutil"
+)
+
+// UndoStats reports how much content the undo history holds. Spilled content lives on
+// disk and only counts towards the overall limit.
+type UndoStats struct {
+	Paths          int   `json:"paths"`
+	Versions       int   `json:"versions"`
+	Checkpoints    int   `json:"checkpoints"`
+	MemoryBytes    int64 `json:"memory_bytes"`
+	SpilledBytes   int64 `json:"spilled_bytes"`
+	MaxMemoryBytes int64 `json:"max_memory_bytes"`
+	MaxBytes       int64 `json:"max_bytes"`
+}
+
+func (u *UndoStore) Stats() UndoStats {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	stats := UndoStats{
+		Paths:          len(u.entries),
+		Checkpoints:    len(u.checkpoints),
+		MemoryBytes:    u.memoryBytes,
+		SpilledBytes:   u.bytes - u.memoryBytes,
+		MaxMemoryBytes: u.maxMemoryBytes,
+		MaxBytes:       u.maxBytes,
+	}
+	for _, versions := range u.entries {
+		stats.Versions += len(versions)
+	}
+	return stats
+}
+
+// hold accounts for a version entering the history. Versions above the spill threshold
+// are moved to disk right away.
+func (u *UndoStore) hold(version *UndoVersion) {
+	u.bytes += version.Size
+	if version.spilled {
+		return
+	}
+
+	u.memoryBytes += version.Size
+	if version.Size > u.spillThreshold {
+		if err := u.spill(version); err != nil {
+			u.appCtx.Logger.Warn("undo: failed spilling version to disk, keeping it in memory",
+				"path", version.Path, "error", err.Error())
+		}
+	}
+}
+
+// release accounts for a version leaving the history.
+func (u *UndoStore) release(version *UndoVersion) {
+	u.bytes -= version.Size
+	if !version.spilled {
+		u.memoryBytes -= version.Size
+	}
+}
+
+// touch marks path as the most recently used one.
+func (u *UndoStore) touch(path string) {
+	if el, ok := u.lruAt[path]; ok {
+		u.lru.MoveToBack(el)
+		return
+	}
+	u.lruAt[path] = u.lru.PushBack(path)
+}
+
+// forgetUnused takes path out of the LRU order once it has no undo or redo state left.
+func (u *UndoStore) forgetUnused(path string) {
+	if len(u.entries[path]) > 0 || len(u.redo[path]) > 0 {
+		return
+	}
+	if el, ok := u.lruAt[path]; ok {
+		u.lru.Remove(el)
+		delete(u.lruAt, path)
+	}
+}
+
+// fits reports whether version can be kept at all: one larger than max_bytes on its own
+// would otherwise push every other version out of the history.
+func (u *UndoStore) fits(version *UndoVersion) bool {
+	return version.Size <= u.maxBytes
+}
+
+// content returns the content of version, reading it back from disk when spilled.
+func (u *UndoStore) content(version *UndoVersion) ([]byte, error) {
+	if !version.spilled {
+		return version.Content, nil
+	}
+	return os.ReadFile(filepath.Join(u.spillDir, version.blob))
+}
+
+// spill moves the content of version to a content-addressed blob on disk.
+func (u *UndoStore) spill(version *UndoVersion) error {
+	if u.spillDir == "" {
+		dir, err := os.MkdirTemp("", "mcp-forge-undo-")
+		if err != nil {
+			return err
+		}
+		u.spillDir = dir
+	}
+
+	if version.blob == "" {
+		sum := sha256.Sum256(version.Content)
+		version.blob = hex.EncodeToString(sum[:])
+	}
+	if !u.blobs[version.blob] {
+		if err := fileutil.WriteFileAtomic(filepath.Join(u.spillDir, version.blob), version.Content); err != nil {
+			return err
+		}
+		u.blobs[version.blob] = true
+	}
+
+	u.memoryBytes -= version.Size
+	version.Content = nil
+	version.spilled = true
+	return nil
+}
+
+// enforceLimits spills the versions of the least recently used paths until the content
+// held in memory fits, then drops them until the overall content fits. Each pass goes
+// through the paths once, in LRU order.
+func (u *UndoStore) enforceLimits() {
+	if u.memoryBytes > u.maxMemoryBytes {
+		u.spillLeastRecentlyUsed()
+	}
+	if u.bytes > u.maxBytes {
+		u.evictLeastRecentlyUsed()
+	}
+}
+
+// spillLeastRecentlyUsed moves contents to disk, the oldest versions of the least
+// recently used path first, then the checkpoint copies of files without history left.
+func (u *UndoStore) spillLeastRecentlyUsed() {
+	for el := u.lru.Front(); el != nil && u.memoryBytes > u.maxMemoryBytes; el = el.Next() {
+		path := el.Value.(string)
+
+		var versions []*UndoVersion
+		versions = append(versions, u.entries[path]...)
+		versions = append(versions, u.redo[path]...)
+		for _, cp := range u.checkpoints {
+			if version, ok := cp.files[path]; ok {
+				versions = append(versions, version)
+			}
+		}
+		sort.SliceStable(versions, func(i, j int) bool { return versions[i].CreatedAt.Before(versions[j].CreatedAt) })
+
+		if !u.spillAll(versions) {
+			return
+		}
+	}
+
+	for _, cp := range u.checkpoints {
+		if u.memoryBytes <= u.maxMemoryBytes {
+			return
+		}
+		versions := make([]*UndoVersion, 0, len(cp.files))
+		for _, path := range cp.paths() {
+			if version, ok := cp.files[path]; ok {
+				versions = append(versions, version)
+			}
+		}
+		if !u.spillAll(versions) {
+			return
+		}
+	}
+}
+
+// spillAll spills versions in order until the memory limit is met. It reports false
+// when spilling failed and there is no point in trying further.
+func (u *UndoStore) spillAll(versions []*UndoVersion) bool {
+	for _, version := range versions {
+		if u.memoryBytes <= u.maxMemoryBytes {
+			return true
+		}
+		if version.spilled || version.Size == 0 {
+			continue
+		}
+		if err := u.spill(version); err != nil {
+			u.appCtx.Logger.Warn("undo: failed spilling version to disk", "path", version.Path, "error", err.Error())
+			return false
+		}
+	}
+	return true
+}
+
+// evictLeastRecentlyUsed drops versions until the overall content fits: the oldest undo
+// versions of the least recently used paths first, then the furthest redo states of
+// such paths, then the oldest checkpoints.
+func (u *UndoStore) evictLeastRecentlyUsed() {
+	// excess returns how many versions from the start of stack must go to fit the limit
+	excess := func(stack []*UndoVersion) int {
+		over := u.bytes - u.maxBytes
+		n := 0
+		for n < len(stack) && over > 0 {
+			over -= stack[n].Size
+			n++
+		}
+		return n
+	}
+
+	for el := u.lru.Front(); el != nil && u.bytes > u.maxBytes; {
+		next := el.Next()
+		path := el.Value.(string)
+		if n := excess(u.entries[path]); n > 0 {
+			u.drop(path, n)
+		}
+		el = next
+	}
+
+	for el := u.lru.Front(); el != nil && u.bytes > u.maxBytes; {
+		next := el.Next()
+		path := el.Value.(string)
+		if n := excess(u.redo[path]); n > 0 {
+			u.dropRedo(path, n)
+		}
+		el = next
+	}
+
+	for len(u.checkpoints) > 0 && u.bytes > u.maxBytes {
+		u.removeCheckpoints(0, 1)
+	}
+}
+
+// sync schedules a flush of the changed history, done in the background by Start.
+// Callers hold the lock.
+func (u *UndoStore) sync() {
+	u.dirty = true
+}
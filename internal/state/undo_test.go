@@ -0,0 +1,180 @@
+package state
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	//
+	"mcp-forge/api"
+	"mcp-forge/internal/globals"
+)
+
+func newTestUndoStore(t *testing.T, config api.UndoConfig) *UndoStore {
+	t.Helper()
+
+	appCtx := &globals.ApplicationContext{
+		Logger: slog.New(slog.NewTextHandler(io.Discard, nil)),
+		Config: &api.Configuration{Undo: config},
+	}
+	u := NewUndoStore(appCtx)
+	t.Cleanup(u.Close)
+	return u
+}
+
+// writeTracked writes content to path the way the tools do, saving undo state first.
+func writeTracked(t *testing.T, u *UndoStore, path, content string, origin UndoOrigin) {
+	t.Helper()
+
+	if err := u.Save(path, origin); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// readTracked returns the content of path, or "<missing>" when it does not exist.
+func readTracked(t *testing.T, path string) string {
+	t.Helper()
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return "<missing>"
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+// checkError fails unless err contains want, or is nil when want is empty.
+func checkError(t *testing.T, err error, want string) {
+	t.Helper()
+
+	switch {
+	case want == "" && err != nil:
+		t.Fatalf("unexpected error: %s", err)
+	case want != "" && (err == nil || !strings.Contains(err.Error(), want)):
+		t.Fatalf("got error %v, want one containing %q", err, want)
+	}
+}
+
+func TestUndoRestore(t *testing.T) {
+	tests := []struct {
+		name       string
+		maxVersion int
+		created    bool
+		writes     int
+		steps      int
+		version    string
+		want       string
+		remaining  int
+		wantErr    string
+	}{
+		{name: "newest change", writes: 1, steps: 1, want: "v0", remaining: 0},
+		{name: "several steps", writes: 3, steps: 2, want: "v1", remaining: 1},
+		{name: "by version ID", writes: 3, version: "v2", want: "v1", remaining: 1},
+		{name: "created file is removed", created: true, writes: 1, steps: 2, want: "<missing>", remaining: 0},
+		{name: "oldest versions are trimmed", maxVersion: 2, writes: 3, steps: 2, want: "v1", remaining: 0},
+		{name: "too many steps", writes: 1, steps: 3, want: "v1", remaining: 1, wantErr: "cannot undo 3 steps"},
+		{name: "trimmed steps", maxVersion: 2, writes: 3, steps: 3, want: "v3", remaining: 2, wantErr: "2 versions available"},
+		{name: "unknown version", writes: 1, version: "v9", want: "v1", remaining: 1, wantErr: `no undo version "v9"`},
+		{name: "no history", steps: 1, want: "v0", wantErr: "no undo history"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u := newTestUndoStore(t, api.UndoConfig{MaxVersionsPerPath: tt.maxVersion})
+			path := filepath.Join(t.TempDir(), "file.txt")
+
+			// The file starts as v0, created through the tools when created is set, then
+			// holds v1, v2... Without created, version vN holds the content before vN
+			if tt.created {
+				writeTracked(t, u, path, "v0", alice)
+			} else if err := os.WriteFile(path, []byte("v0"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			for i := 1; i <= tt.writes; i++ {
+				writeTracked(t, u, path, fmt.Sprintf("v%d", i), alice)
+			}
+
+			var err error
+			if tt.version != "" {
+				_, err = u.RestoreVersion(path, tt.version, alice, false)
+			} else {
+				_, err = u.Restore(path, tt.steps, alice, false)
+			}
+			checkError(t, err, tt.wantErr)
+
+			if got := readTracked(t, path); got != tt.want {
+				t.Errorf("file holds %q, want %q", got, tt.want)
+			}
+			if got := len(u.Versions(path, alice, false)); got != tt.remaining {
+				t.Errorf("got %d versions left, want %d", got, tt.remaining)
+			}
+		})
+	}
+}
+
+// TestRedo runs sequences of operations on a file written as v0, v1, v2 by the tools.
+// "undo N" undoes N steps, "write X" writes X through the tools.
+func TestRedo(t *testing.T) {
+	tests := []struct {
+		name    string
+		ops     []string
+		want    string
+		redo    int
+		wantErr string
+	}{
+		{name: "after undo", ops: []string{"undo 1", "redo"}, want: "v2"},
+		{name: "one step at a time", ops: []string{"undo 2", "redo"}, want: "v1", redo: 1},
+		{name: "all steps in order", ops: []string{"undo 3", "redo", "redo", "redo"}, want: "v2"},
+		{name: "alternating", ops: []string{"undo 1", "undo 1", "redo", "undo 1", "undo 1", "redo", "redo", "redo"}, want: "v2"},
+		{name: "redo is undoable", ops: []string{"undo 2", "redo", "undo 1"}, want: "v0", redo: 2},
+		{name: "nothing undone", ops: []string{"redo"}, want: "v2", wantErr: "nothing to redo"},
+		{name: "everything redone", ops: []string{"undo 1", "redo", "redo"}, want: "v2", wantErr: "nothing to redo"},
+		{name: "new edit clears redo", ops: []string{"undo 2", "write v3", "redo"}, want: "v3", wantErr: "nothing to redo"},
+		{name: "new edit keeps undo", ops: []string{"undo 2", "write v3", "undo 1"}, want: "v0", redo: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u := newTestUndoStore(t, api.UndoConfig{})
+			path := filepath.Join(t.TempDir(), "file.txt")
+			for _, content := range []string{"v0", "v1", "v2"} {
+				writeTracked(t, u, path, content, alice)
+			}
+
+			var err error
+			for i, op := range tt.ops {
+				name, arg, _ := strings.Cut(op, " ")
+				switch name {
+				case "undo":
+					var steps int
+					fmt.Sscan(arg, &steps)
+					_, err = u.Restore(path, steps, alice, false)
+				case "redo":
+					_, err = u.Redo(path, alice, false)
+				case "write":
+					writeTracked(t, u, path, arg, alice)
+				}
+				if err != nil && i < len(tt.ops)-1 {
+					t.Fatalf("%s: %s", op, err)
+				}
+			}
+			checkError(t, err, tt.wantErr)
+
+			if got := readTracked(t, path); got != tt.want {
+				t.Errorf("file holds %q, want %q", got, tt.want)
+			}
+			if got := len(u.RedoVersions(path, alice, false)); got != tt.redo {
+				t.Errorf("got %d changes left to redo, want %d", got, tt.redo)
+			}
+		})
+	}
+}
@@ -0,0 +1,153 @@
+package tools
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// dirDiffChange is a file present on both sides whose content differs. Diff is empty for
+// binary or oversized files, which are only compared by hash.
+type dirDiffChange struct {
+	Path   string `json:"path"`
+	Binary bool   `json:"binary,omitempty"`
+	Diff   string `json:"diff,omitempty"`
+	Note   string `json:"note,omitempty"`
+}
+
+type dirDiffResult struct {
+	Added     []string        `json:"added"`
+	Removed   []string        `json:"removed"`
+	Changed   []dirDiffChange `json:"changed"`
+	Unchanged int             `json:"unchanged"`
+}
+
+// diffDirs compares the files below rootA and rootB, matched by relative path. Files are
+// selected with the same include/exclude and ignore-file rules as search.
+func diffDirs(ctx context.Context, rootA, rootB string, opts searchOptions) (*dirDiffResult, error) {
+	filesA, err := listDiffFiles(ctx, rootA, opts)
+	if err != nil {
+		return nil, err
+	}
+	filesB, err := listDiffFiles(ctx, rootB, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &dirDiffResult{
+		Added:   []string{},
+		Removed: []string{},
+		Changed: []dirDiffChange{},
+	}
+
+	for rel := range filesA {
+		if !filesB[rel] {
+			result.Removed = append(result.Removed, rel)
+		}
+	}
+
+	var common []string
+	for rel := range filesB {
+		if filesA[rel] {
+			common = append(common, rel)
+		} else {
+			result.Added = append(result.Added, rel)
+		}
+	}
+
+	sort.Strings(result.Added)
+	sort.Strings(result.Removed)
+	sort.Strings(common)
+
+	for _, rel := range common {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		change, err := diffDirFile(filepath.Join(rootA, rel), filepath.Join(rootB, rel), opts)
+		if err != nil {
+			result.Changed = append(result.Changed, dirDiffChange{Path: rel, Note: err.Error()})
+			continue
+		}
+		if change == nil {
+			result.Unchanged++
+			continue
+		}
+		change.Path = rel
+		result.Changed = append(result.Changed, *change)
+	}
+
+	return result, nil
+}
+
+// listDiffFiles returns the selected files below root as slash-separated relative paths.
+func listDiffFiles(ctx context.Context, root string, opts searchOptions) (map[string]bool, error) {
+	files := make(map[string]bool)
+	err := walkSearchable(ctx, root, opts, func(filePath string) error {
+		rel, err := filepath.Rel(root, filePath)
+		if err != nil {
+			return nil
+		}
+		files[filepath.ToSlash(rel)] = true
+		return nil
+	})
+	return files, err
+}
+
+// diffDirFile compares two files by hash first, and returns nil when they are identical.
+// Text files within opts.maxFileSize also get a unified diff with opts.contextLines of context.
+func diffDirFile(pathA, pathB string, opts searchOptions) (*dirDiffChange, error) {
+	hashA, sizeA, err := hashFile(pathA)
+	if err != nil {
+		return nil, err
+	}
+	hashB, sizeB, err := hashFile(pathB)
+	if err != nil {
+		return nil, err
+	}
+	if hashA == hashB {
+		return nil, nil
+	}
+
+	if max(sizeA, sizeB) > opts.maxFileSize {
+		return &dirDiffChange{Note: "file too large to diff, contents differ"}, nil
+	}
+
+	dataA, err := os.ReadFile(pathA)
+	if err != nil {
+		return nil, err
+	}
+	dataB, err := os.ReadFile(pathB)
+	if err != nil {
+		return nil, err
+	}
+
+	if isBinary(dataA[:min(len(dataA), binarySniffSize)]) || isBinary(dataB[:min(len(dataB), binarySniffSize)]) {
+		return &dirDiffChange{Binary: true}, nil
+	}
+
+	diff := computeDiff(pathA, pathB, splitLines(string(dataA)), splitLines(string(dataB)), 0, 0, opts.contextLines)
+	if diff == "" {
+		return &dirDiffChange{Note: "files differ only in line endings or the final newline"}, nil
+	}
+	return &dirDiffChange{Diff: diff}, nil
+}
+
+func hashFile(path string) (string, int64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer file.Close()
+
+	h := sha256.New()
+	n, err := io.Copy(h, file)
+	if err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(h.Sum(nil)), n, nil
+}
@@ -0,0 +1,149 @@
+package tools
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Granularities of the diff tool. Line is the classic unified diff; word and char refine
+// each block of replaced lines into inline markers, like git diff --word-diff.
+const (
+	diffGranularityLine = "line"
+	diffGranularityWord = "word"
+	diffGranularityChar = "char"
+)
+
+// inlineHunkLines renders the lines of hunk with replaced blocks merged into "~" lines,
+// where removed text is wrapped in [-...-] and added text in {+...+}. Context lines keep
+// their " " prefix, and pure insertions or deletions keep their "+" or "-" lines.
+func inlineHunkLines(hunk diffHunk, granularity string) []string {
+	var out []string
+	lines := hunk.Lines
+
+	for i := 0; i < len(lines); {
+		if lines[i].Op == ' ' {
+			out = append(out, " "+lines[i].Text)
+			i++
+			continue
+		}
+
+		// A change block is a run of removed lines followed by a run of added lines
+		var removed, added []string
+		for i < len(lines) && lines[i].Op == '-' {
+			removed = append(removed, lines[i].Text)
+			i++
+		}
+		for i < len(lines) && lines[i].Op == '+' {
+			added = append(added, lines[i].Text)
+			i++
+		}
+
+		switch {
+		case len(removed) == 0:
+			for _, text := range added {
+				out = append(out, "+"+text)
+			}
+		case len(added) == 0:
+			for _, text := range removed {
+				out = append(out, "-"+text)
+			}
+		default:
+			merged := inlineDiff(strings.Join(removed, "\n"), strings.Join(added, "\n"), granularity)
+			for _, text := range strings.Split(merged, "\n") {
+				out = append(out, "~"+text)
+			}
+		}
+	}
+
+	return out
+}
+
+// inlineDiff diffs two texts token by token and marks the changed tokens in place.
+// Markers never span a line break, so each output line reads on its own.
+func inlineDiff(oldText, newText, granularity string) string {
+	tokenize := diffWords
+	if granularity == diffGranularityChar {
+		tokenize = diffChars
+	}
+	oldTokens, newTokens := tokenize(oldText), tokenize(newText)
+	changedOld, changedNew := myersDiff(oldTokens, newTokens)
+
+	var sb strings.Builder
+	mark := func(tokens []string, open, close string) {
+		for k, segment := range strings.Split(strings.Join(tokens, ""), "\n") {
+			if k > 0 {
+				sb.WriteByte('\n')
+			}
+			if segment != "" {
+				sb.WriteString(open + segment + close)
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < len(oldTokens) || j < len(newTokens) {
+		var removed, added []string
+		for i < len(oldTokens) && changedOld[i] {
+			removed = append(removed, oldTokens[i])
+			i++
+		}
+		for j < len(newTokens) && changedNew[j] {
+			added = append(added, newTokens[j])
+			j++
+		}
+		mark(removed, "[-", "-]")
+		mark(added, "{+", "+}")
+
+		if i < len(oldTokens) && j < len(newTokens) && !changedOld[i] && !changedNew[j] {
+			sb.WriteString(oldTokens[i])
+			i++
+			j++
+		}
+	}
+
+	return sb.String()
+}
+
+// diffWords splits text into runs of letters and digits, runs of spaces, and single
+// punctuation characters. Line breaks are always tokens of their own.
+func diffWords(text string) []string {
+	class := func(r rune) int {
+		switch {
+		case r == '\n':
+			return 0
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_':
+			return 1
+		case unicode.IsSpace(r):
+			return 2
+		}
+		return 3
+	}
+
+	var tokens []string
+	start := 0
+	for start < len(text) {
+		r, size := utf8.DecodeRuneInString(text[start:])
+		end := start + size
+		if c := class(r); c == 1 || c == 2 {
+			for end < len(text) {
+				next, nextSize := utf8.DecodeRuneInString(text[end:])
+				if class(next) != c {
+					break
+				}
+				end += nextSize
+			}
+		}
+		tokens = append(tokens, text[start:end])
+		start = end
+	}
+	return tokens
+}
+
+func diffChars(text string) []string {
+	tokens := make([]string, 0, len(text))
+	for _, r := range text {
+		tokens = append(tokens, string(r))
+	}
+	return tokens
+}
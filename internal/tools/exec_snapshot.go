@@ -0,0 +1,239 @@
+package tools
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	//
+	"mcp-forge/internal/state"
+)
+
+const (
+	// execSnapshotMaxFiles bounds how many files a snapshot of the workdir tracks. Files
+	// past it, in walk order, are left out of the report
+	execSnapshotMaxFiles = 20000
+
+	// execSnapshotMaxBytes bounds the content kept in memory by a snapshot. Larger trees
+	// are still tracked by hash, but changes to files past the budget cannot be undone
+	execSnapshotMaxBytes = 16 * 1024 * 1024
+)
+
+// execSnapshot is the workdir tree right before a command runs. Contents are kept until
+// the command is done, within execSnapshotMaxBytes, then only those of the files it
+// changed are registered for undo.
+type execSnapshot struct {
+	root      string
+	startedAt time.Time
+	files     map[string]execSnapshotFile
+
+	// last is the last file tracked when the tree has more than execSnapshotMaxFiles
+	last string
+}
+
+// execSnapshotFile identifies the content of a file. Size and modification time spare
+// hashing it again when neither changed; content is nil past the memory budget.
+type execSnapshotFile struct {
+	size    int64
+	modTime time.Time
+	hash    [sha256.Size]byte
+	content []byte
+}
+
+// execChanges lists the files a command added, modified or deleted, relative to its
+// workdir. Checkpoint names the operation that rolls them all back, and NotUndoable the
+// changed files whose earlier content was not kept.
+type execChanges struct {
+	Added       []string `json:"added"`
+	Modified    []string `json:"modified"`
+	Deleted     []string `json:"deleted"`
+	NotUndoable []string `json:"not_undoable,omitempty"`
+	Checkpoint  string   `json:"checkpoint,omitempty"`
+	Note        string   `json:"note,omitempty"`
+}
+
+// takeExecSnapshot records every file under root that is not ignored by the ignore files.
+func takeExecSnapshot(ctx context.Context, root string) (*execSnapshot, error) {
+	snapshot := &execSnapshot{
+		root:      root,
+		startedAt: time.Now(),
+		files:     make(map[string]execSnapshotFile),
+	}
+
+	budget := int64(execSnapshotMaxBytes)
+	err := walkSearchable(ctx, root, searchOptions{gitignore: true}, func(filePath string) error {
+		if len(snapshot.files) >= execSnapshotMaxFiles {
+			return filepath.SkipAll
+		}
+
+		file, err := readExecSnapshotFile(filePath, budget)
+		if err != nil {
+			return nil
+		}
+		budget -= int64(len(file.content))
+
+		snapshot.files[filePath] = file
+		snapshot.last = filePath
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(snapshot.files) < execSnapshotMaxFiles {
+		snapshot.last = ""
+	}
+	return snapshot, nil
+}
+
+// readExecSnapshotFile hashes a file, keeping its content when it fits in budget.
+func readExecSnapshotFile(filePath string, budget int64) (execSnapshotFile, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return execSnapshotFile{}, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return execSnapshotFile{}, err
+	}
+	file := execSnapshotFile{size: info.Size(), modTime: info.ModTime()}
+
+	if info.Size() <= budget {
+		content, err := io.ReadAll(f)
+		if err != nil {
+			return execSnapshotFile{}, err
+		}
+		file.hash = sha256.Sum256(content)
+		file.content = content
+		return file, nil
+	}
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return execSnapshotFile{}, err
+	}
+	copy(file.hash[:], hash.Sum(nil))
+	return file, nil
+}
+
+// changed reports whether filePath no longer holds the content recorded in the snapshot.
+func (f execSnapshotFile) changed(filePath string) bool {
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return true
+	}
+	if info.Size() == f.size && info.ModTime().Equal(f.modTime) {
+		return false
+	}
+
+	after, err := readExecSnapshotFile(filePath, 0)
+	return err != nil || after.hash != f.hash
+}
+
+// tracked reports whether filePath falls within the part of the tree the snapshot covers.
+func (s *execSnapshot) tracked(filePath string) bool {
+	return s.last == "" || walkOrderCompare(filePath, s.last) <= 0
+}
+
+// recordExecChanges compares the workdir with the snapshot taken before the command and
+// registers the earlier state of every changed file as one undoable operation.
+func (tm *ToolsManager) recordExecChanges(ctx context.Context, snapshot *execSnapshot) *execChanges {
+	changes := &execChanges{Added: []string{}, Modified: []string{}, Deleted: []string{}}
+	var states []state.UndoFileState
+
+	modified := func(filePath string, before execSnapshotFile) {
+		changes.Modified = append(changes.Modified, execRelPath(snapshot.root, filePath))
+		if before.content == nil {
+			changes.NotUndoable = append(changes.NotUndoable, execRelPath(snapshot.root, filePath))
+			return
+		}
+		states = append(states, state.UndoFileState{Path: filePath, Content: before.content, Existed: true})
+	}
+
+	seen := make(map[string]bool, len(snapshot.files))
+	_ = walkSearchable(context.WithoutCancel(ctx), snapshot.root, searchOptions{gitignore: true}, func(filePath string) error {
+		if !snapshot.tracked(filePath) {
+			return filepath.SkipAll
+		}
+		seen[filePath] = true
+
+		before, existed := snapshot.files[filePath]
+		if !existed {
+			changes.Added = append(changes.Added, execRelPath(snapshot.root, filePath))
+			states = append(states, state.UndoFileState{Path: filePath})
+			return nil
+		}
+
+		if before.changed(filePath) {
+			modified(filePath, before)
+		}
+		return nil
+	})
+
+	// Files the command got ignored, e.g. by editing .gitignore, are still compared
+	var unseen []string
+	for filePath := range snapshot.files {
+		if !seen[filePath] {
+			unseen = append(unseen, filePath)
+		}
+	}
+	sort.Strings(unseen)
+
+	for _, filePath := range unseen {
+		before := snapshot.files[filePath]
+		if _, err := os.Lstat(filePath); err == nil {
+			if before.changed(filePath) {
+				modified(filePath, before)
+			}
+			continue
+		}
+
+		changes.Deleted = append(changes.Deleted, execRelPath(snapshot.root, filePath))
+		if before.content == nil {
+			changes.NotUndoable = append(changes.NotUndoable, execRelPath(snapshot.root, filePath))
+			continue
+		}
+		states = append(states, state.UndoFileState{Path: filePath, Content: before.content, Existed: true})
+	}
+	sort.Strings(changes.Modified)
+	sort.Strings(changes.NotUndoable)
+
+	var notes []string
+	if snapshot.last != "" {
+		notes = append(notes, fmt.Sprintf("the workdir has more than %d files, only those up to %s were tracked", execSnapshotMaxFiles, execRelPath(snapshot.root, snapshot.last)))
+	}
+	if len(changes.NotUndoable) > 0 {
+		notes = append(notes, fmt.Sprintf("the earlier content of not_undoable files was past the %d bytes kept by a snapshot", execSnapshotMaxBytes))
+	}
+
+	if len(states) > 0 {
+		sort.Slice(states, func(i, j int) bool { return states[i].Path < states[j].Path })
+
+		name, err := tm.dependencies.Undo.RecordOperation("exec", states, undoOriginFromCtx(ctx, "exec"), snapshot.startedAt)
+		if err != nil {
+			notes = append(notes, err.Error()+"; use undo on each file instead")
+		} else {
+			changes.Checkpoint = name
+			notes = append(notes, fmt.Sprintf("checkpoint rollback of %q reverts the undoable changes", name))
+		}
+	}
+
+	changes.Note = strings.Join(notes, "; ")
+	return changes
+}
+
+func execRelPath(root, filePath string) string {
+	rel, err := filepath.Rel(root, filePath)
+	if err != nil {
+		return filePath
+	}
+	return filepath.ToSlash(rel)
+}
@@ -0,0 +1,171 @@
+package tools
+
+import (
+	"bytes"
+	"go/ast"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"strings"
+)
+
+// goSymbol is a top-level declaration in a Go file. Lines are 0-based, like read_file,
+// and EndLine is inclusive.
+type goSymbol struct {
+	Name      string `json:"name"`
+	Kind      string `json:"kind"`
+	Receiver  string `json:"receiver,omitempty"`
+	Signature string `json:"signature,omitempty"`
+	File      string `json:"file"`
+	StartLine int    `json:"start_line"`
+	EndLine   int    `json:"end_line"`
+	Exported  bool   `json:"exported"`
+
+	// docLine is the first line of the doc comment, or StartLine when there is none
+	docLine int
+}
+
+// QualifiedName returns Receiver.Name for methods and Name otherwise.
+func (s goSymbol) QualifiedName() string {
+	if s.Receiver != "" {
+		return s.Receiver + "." + s.Name
+	}
+	return s.Name
+}
+
+// parseGoSymbols lists the top-level declarations of a Go source file in source order:
+// functions, methods with their receiver type, types, consts and vars.
+func parseGoSymbols(path string, src []byte) ([]goSymbol, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, path, src, parser.ParseComments|parser.SkipObjectResolution)
+	if err != nil {
+		return nil, err
+	}
+
+	line := func(pos token.Pos) int {
+		return fset.Position(pos).Line - 1
+	}
+	docLine := func(doc *ast.CommentGroup, fallback token.Pos) int {
+		if doc != nil {
+			return line(doc.Pos())
+		}
+		return line(fallback)
+	}
+
+	var symbols []goSymbol
+	for _, decl := range file.Decls {
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			symbol := goSymbol{
+				Name:      d.Name.Name,
+				Kind:      "func",
+				Signature: funcSignature(fset, d),
+				File:      path,
+				StartLine: line(d.Pos()),
+				EndLine:   line(d.End()),
+				Exported:  d.Name.IsExported(),
+				docLine:   docLine(d.Doc, d.Pos()),
+			}
+			if d.Recv != nil && len(d.Recv.List) > 0 {
+				symbol.Kind = "method"
+				symbol.Receiver = receiverTypeName(d.Recv.List[0].Type)
+			}
+			symbols = append(symbols, symbol)
+
+		case *ast.GenDecl:
+			kind := ""
+			switch d.Tok {
+			case token.TYPE:
+				kind = "type"
+			case token.CONST:
+				kind = "const"
+			case token.VAR:
+				kind = "var"
+			default:
+				continue
+			}
+
+			// An ungrouped declaration spans its keyword and doc; grouped specs only themselves
+			for _, spec := range d.Specs {
+				start, end, doc := spec.Pos(), spec.End(), specDoc(spec)
+				if !d.Lparen.IsValid() {
+					start, end, doc = d.Pos(), d.End(), d.Doc
+				}
+
+				switch s := spec.(type) {
+				case *ast.TypeSpec:
+					symbols = append(symbols, goSymbol{
+						Name:      s.Name.Name,
+						Kind:      kind,
+						File:      path,
+						StartLine: line(start),
+						EndLine:   line(end),
+						Exported:  s.Name.IsExported(),
+						docLine:   docLine(doc, start),
+					})
+
+				case *ast.ValueSpec:
+					for _, name := range s.Names {
+						if name.Name == "_" {
+							continue
+						}
+						symbols = append(symbols, goSymbol{
+							Name:      name.Name,
+							Kind:      kind,
+							File:      path,
+							StartLine: line(start),
+							EndLine:   line(end),
+							Exported:  name.IsExported(),
+							docLine:   docLine(doc, start),
+						})
+					}
+				}
+			}
+		}
+	}
+
+	return symbols, nil
+}
+
+func specDoc(spec ast.Spec) *ast.CommentGroup {
+	switch s := spec.(type) {
+	case *ast.TypeSpec:
+		return s.Doc
+	case *ast.ValueSpec:
+		return s.Doc
+	}
+	return nil
+}
+
+// receiverTypeName strips pointers and type parameters from a receiver type expression.
+func receiverTypeName(expr ast.Expr) string {
+	for {
+		switch e := expr.(type) {
+		case *ast.StarExpr:
+			expr = e.X
+		case *ast.IndexExpr:
+			expr = e.X
+		case *ast.IndexListExpr:
+			expr = e.X
+		case *ast.ParenExpr:
+			expr = e.X
+		case *ast.Ident:
+			return e.Name
+		default:
+			return ""
+		}
+	}
+}
+
+// funcSignature renders the declaration line of a function without its body.
+func funcSignature(fset *token.FileSet, d *ast.FuncDecl) string {
+	stripped := *d
+	stripped.Body = nil
+	stripped.Doc = nil
+
+	var buf bytes.Buffer
+	if err := printer.Fprint(&buf, fset, &stripped); err != nil {
+		return ""
+	}
+	return strings.Join(strings.Fields(buf.String()), " ")
+}
@@ -3,11 +3,14 @@ package tools
 import (
 	"context"
 	"fmt"
+	"path/filepath"
 	"strings"
 
 	"mcp-forge/internal/middlewares"
+	"mcp-forge/internal/state"
 
 	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
 )
 
 // jwtPayloadFromCtx extracts the verified JWT payload from the context.
@@ -16,6 +19,57 @@ func jwtPayloadFromCtx(ctx context.Context) map[string]any {
 	return middlewares.JWTPayloadFromContext(ctx)
 }
 
+// sessionIDFromCtx returns the MCP session ID of the client issuing the request.
+// Returns an empty string when the transport does not carry a session.
+func sessionIDFromCtx(ctx context.Context) string {
+	if session := server.ClientSessionFromContext(ctx); session != nil {
+		return session.SessionID()
+	}
+	return ""
+}
+
+// undoOriginFromCtx describes the tool call issuing a write, for the undo history.
+func undoOriginFromCtx(ctx context.Context, tool string) state.UndoOrigin {
+	origin := state.UndoOrigin{Tool: tool, Session: sessionIDFromCtx(ctx)}
+	if subject, ok := jwtPayloadFromCtx(ctx)["sub"].(string); ok {
+		origin.Subject = subject
+	}
+	return origin
+}
+
+// undoOverride reports whether the caller may undo changes made by other sessions on all
+// of paths, which takes an RBAC rule granting undo_any.
+func (tm *ToolsManager) undoOverride(ctx context.Context, paths []string) bool {
+	if len(paths) == 0 {
+		return false
+	}
+	payload := jwtPayloadFromCtx(ctx)
+	for _, path := range paths {
+		if !tm.dependencies.RBAC.Grants("undo_any", path, payload) {
+			return false
+		}
+	}
+	return true
+}
+
+// walkOrderCompare compares two paths in the order filepath.WalkDir visits them:
+// a directory before its contents, siblings in lexical order.
+func walkOrderCompare(a, b string) int {
+	as := strings.Split(filepath.ToSlash(a), "/")
+	bs := strings.Split(filepath.ToSlash(b), "/")
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		if c := strings.Compare(as[i], bs[i]); c != 0 {
+			return c
+		}
+	}
+	return len(as) - len(bs)
+}
+
+// isPathWithin reports whether path is dir itself or lies below it.
+func isPathWithin(path, dir string) bool {
+	return path == dir || strings.HasPrefix(path, strings.TrimSuffix(dir, string(filepath.Separator))+string(filepath.Separator))
+}
+
 func sanitizePath(path string) error {
 	openIdx := strings.Index(path, "{")
 	if openIdx == -1 {
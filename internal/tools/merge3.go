@@ -0,0 +1,115 @@
+package tools
+
+import (
+	"slices"
+)
+
+// mergeConflict is a region changed differently on both sides. Starts are 0-based line
+// numbers in each input; MergedStart is the line of the opening marker in the output.
+type mergeConflict struct {
+	MergedStart int      `json:"merged_start"`
+	BaseStart   int      `json:"base_start"`
+	Base        []string `json:"base"`
+	OursStart   int      `json:"ours_start"`
+	Ours        []string `json:"ours"`
+	TheirsStart int      `json:"theirs_start"`
+	Theirs      []string `json:"theirs"`
+}
+
+// mergeMarkers configures the conflict markers written into the merged output.
+type mergeMarkers struct {
+	ours   string
+	base   string
+	theirs string
+
+	// diff3 also writes the base version of each conflict, between ||||||| and =======
+	diff3 bool
+}
+
+// merge3 merges the changes made from base to ours and from base to theirs. Regions
+// changed on one side only, or identically on both, are taken as is; the others become
+// conflicts surrounded by markers in the returned lines.
+func merge3(base, ours, theirs []string, markers mergeMarkers) ([]string, []mergeConflict) {
+	matchOurs := matchLines(base, ours)
+	matchTheirs := matchLines(base, theirs)
+
+	var merged []string
+	var conflicts []mergeConflict
+
+	i, j, k := 0, 0, 0
+	for i < len(base) || j < len(ours) || k < len(theirs) {
+		// A base line kept at the current position on both sides is stable
+		if i < len(base) && matchOurs[i] == j && matchTheirs[i] == k {
+			merged = append(merged, base[i])
+			i++
+			j++
+			k++
+			continue
+		}
+
+		// Otherwise the unstable region runs up to the next base line kept on both sides
+		next := i
+		for next < len(base) && (matchOurs[next] < 0 || matchTheirs[next] < 0) {
+			next++
+		}
+		endOurs, endTheirs := len(ours), len(theirs)
+		if next < len(base) {
+			endOurs, endTheirs = matchOurs[next], matchTheirs[next]
+		}
+
+		baseChunk := base[i:next]
+		oursChunk := ours[j:endOurs]
+		theirsChunk := theirs[k:endTheirs]
+
+		switch {
+		case slices.Equal(baseChunk, oursChunk):
+			merged = append(merged, theirsChunk...)
+		case slices.Equal(baseChunk, theirsChunk), slices.Equal(oursChunk, theirsChunk):
+			merged = append(merged, oursChunk...)
+		default:
+			conflicts = append(conflicts, mergeConflict{
+				MergedStart: len(merged),
+				BaseStart:   i,
+				Base:        slices.Clone(baseChunk),
+				OursStart:   j,
+				Ours:        slices.Clone(oursChunk),
+				TheirsStart: k,
+				Theirs:      slices.Clone(theirsChunk),
+			})
+			merged = append(merged, "<<<<<<< "+markers.ours)
+			merged = append(merged, oursChunk...)
+			if markers.diff3 {
+				merged = append(merged, "||||||| "+markers.base)
+				merged = append(merged, baseChunk...)
+			}
+			merged = append(merged, "=======")
+			merged = append(merged, theirsChunk...)
+			merged = append(merged, ">>>>>>> "+markers.theirs)
+		}
+
+		i, j, k = next, endOurs, endTheirs
+	}
+
+	return merged, conflicts
+}
+
+// matchLines maps each line of base to the index of the same line in other when it is
+// part of their longest common subsequence, and to -1 otherwise.
+func matchLines(base, other []string) []int {
+	changedBase, changedOther := myersDiff(base, other)
+
+	match := make([]int, len(base))
+	j := 0
+	for i := range base {
+		match[i] = -1
+		if changedBase[i] {
+			continue
+		}
+		for changedOther[j] {
+			j++
+		}
+		match[i] = j
+		j++
+	}
+	return match
+}
@@ -0,0 +1,131 @@
+package tools
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestMerge3(t *testing.T) {
+	markers := mergeMarkers{ours: "ours", base: "base", theirs: "theirs"}
+
+	tests := []struct {
+		name               string
+		base, ours, theirs string
+		diff3              bool
+		want               string
+		conflicts          []mergeConflict
+	}{
+		{
+			name: "unchanged",
+			base: "a b c", ours: "a b c", theirs: "a b c",
+			want: "a b c",
+		},
+		{
+			name: "ours only",
+			base: "a b c", ours: "a B c", theirs: "a b c",
+			want: "a B c",
+		},
+		{
+			name: "theirs only",
+			base: "a b c", ours: "a b c", theirs: "a b C",
+			want: "a b C",
+		},
+		{
+			name: "both sides, different regions",
+			base: "a b c d e", ours: "A b c d e", theirs: "a b c d E",
+			want: "A b c d E",
+		},
+		{
+			name: "same change on both sides",
+			base: "a b c", ours: "a X c", theirs: "a X c",
+			want: "a X c",
+		},
+		{
+			name: "deletion on one side",
+			base: "a b c", ours: "a c", theirs: "a b c",
+			want: "a c",
+		},
+		{
+			name: "insertions at both ends",
+			base: "b", ours: "a b", theirs: "b c",
+			want: "a b c",
+		},
+		{
+			name: "empty base, same content added",
+			base: "", ours: "x", theirs: "x",
+			want: "x",
+		},
+		{
+			name: "conflicting edits",
+			base: "a b c", ours: "a X c", theirs: "a Y c",
+			want: "a <<<<<<< ours X ======= Y >>>>>>> theirs c",
+			conflicts: []mergeConflict{
+				{MergedStart: 1, BaseStart: 1, Base: []string{"b"}, OursStart: 1, Ours: []string{"X"}, TheirsStart: 1, Theirs: []string{"Y"}},
+			},
+		},
+		{
+			name: "conflicting edits with diff3 markers",
+			base: "a b c", ours: "a X c", theirs: "a Y c",
+			diff3: true,
+			want:  "a <<<<<<< ours X ||||||| base b ======= Y >>>>>>> theirs c",
+			conflicts: []mergeConflict{
+				{MergedStart: 1, BaseStart: 1, Base: []string{"b"}, OursStart: 1, Ours: []string{"X"}, TheirsStart: 1, Theirs: []string{"Y"}},
+			},
+		},
+		{
+			name: "edit against deletion",
+			base: "a b c", ours: "a X c", theirs: "a c",
+			want: "a <<<<<<< ours X ======= >>>>>>> theirs c",
+			conflicts: []mergeConflict{
+				{MergedStart: 1, BaseStart: 1, Base: []string{"b"}, OursStart: 1, Ours: []string{"X"}, TheirsStart: 1, Theirs: []string{}},
+			},
+		},
+		{
+			name: "different lines appended",
+			base: "a", ours: "a X", theirs: "a Y",
+			want: "a <<<<<<< ours X ======= Y >>>>>>> theirs",
+			conflicts: []mergeConflict{
+				{MergedStart: 1, BaseStart: 1, Base: []string{}, OursStart: 1, Ours: []string{"X"}, TheirsStart: 1, Theirs: []string{"Y"}},
+			},
+		},
+		{
+			name: "two separate conflicts",
+			base: "a b c d e", ours: "a X c Z e", theirs: "a Y c W e",
+			want: "a <<<<<<< ours X ======= Y >>>>>>> theirs c <<<<<<< ours Z ======= W >>>>>>> theirs e",
+			conflicts: []mergeConflict{
+				{MergedStart: 1, BaseStart: 1, Base: []string{"b"}, OursStart: 1, Ours: []string{"X"}, TheirsStart: 1, Theirs: []string{"Y"}},
+				{MergedStart: 7, BaseStart: 3, Base: []string{"d"}, OursStart: 3, Ours: []string{"Z"}, TheirsStart: 3, Theirs: []string{"W"}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := markers
+			m.diff3 = tt.diff3
+
+			merged, conflicts := merge3(strings.Fields(tt.base), strings.Fields(tt.ours), strings.Fields(tt.theirs), m)
+
+			// Markers are written as "<<<<<<< ours"; joining on spaces keeps the table readable
+			if got := strings.Join(merged, " "); got != tt.want {
+				t.Errorf("merged:\ngot  %q\nwant %q", got, tt.want)
+			}
+			if len(conflicts) != len(tt.conflicts) {
+				t.Fatalf("got %d conflicts, want %d: %+v", len(conflicts), len(tt.conflicts), conflicts)
+			}
+			for i, got := range conflicts {
+				if !mergeConflictEqual(got, tt.conflicts[i]) {
+					t.Errorf("conflict %d:\ngot  %+v\nwant %+v", i, got, tt.conflicts[i])
+				}
+			}
+		})
+	}
+}
+
+func mergeConflictEqual(a, b mergeConflict) bool {
+	return a.MergedStart == b.MergedStart &&
+		a.BaseStart == b.BaseStart && slices.Equal(a.Base, b.Base) &&
+		a.OursStart == b.OursStart && slices.Equal(a.Ours, b.Ours) &&
+		a.TheirsStart == b.TheirsStart && slices.Equal(a.Theirs, b.Theirs)
+}
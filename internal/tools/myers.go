@@ -0,0 +1,208 @@
+package tools
+
+// myersMaxCost bounds the number of edits explored for a single middle-snake search.
+// Past it the remaining range is reported as fully replaced: the diff stays correct,
+// only no longer minimal, and pathological inputs cannot run for minutes.
+const myersMaxCost = 4096
+
+// myersDiff marks which lines of a and b are not part of a longest common subsequence,
+// using Myers' O(ND) algorithm with the linear-space divide-and-conquer refinement.
+func myersDiff(a, b []string) (changedA, changedB []bool) {
+	changedA = make([]bool, len(a))
+	changedB = make([]bool, len(b))
+
+	// Lines are interned so that comparisons are integer compares
+	ids := make(map[string]int)
+	intern := func(lines []string) []int {
+		out := make([]int, len(lines))
+		for i, line := range lines {
+			id, ok := ids[line]
+			if !ok {
+				id = len(ids)
+				ids[line] = id
+			}
+			out[i] = id
+		}
+		return out
+	}
+	seqA, seqB := intern(a), intern(b)
+
+	// A line that appears on one side only can never be common: mark it right away and
+	// run the search on the rest, which keeps heavily rewritten files cheap
+	inA := make(map[int]bool, len(seqA))
+	for _, id := range seqA {
+		inA[id] = true
+	}
+	inB := make(map[int]bool, len(seqB))
+	for _, id := range seqB {
+		inB[id] = true
+	}
+
+	var keptA, keptB, indexA, indexB []int
+	for i, id := range seqA {
+		if inB[id] {
+			keptA = append(keptA, id)
+			indexA = append(indexA, i)
+		} else {
+			changedA[i] = true
+		}
+	}
+	for i, id := range seqB {
+		if inA[id] {
+			keptB = append(keptB, id)
+			indexB = append(indexB, i)
+		} else {
+			changedB[i] = true
+		}
+	}
+
+	m := &myers{
+		a:        keptA,
+		b:        keptB,
+		changedA: make([]bool, len(keptA)),
+		changedB: make([]bool, len(keptB)),
+	}
+	m.compare(0, len(keptA), 0, len(keptB))
+
+	for i, changed := range m.changedA {
+		if changed {
+			changedA[indexA[i]] = true
+		}
+	}
+	for i, changed := range m.changedB {
+		if changed {
+			changedB[indexB[i]] = true
+		}
+	}
+
+	return changedA, changedB
+}
+
+type myers struct {
+	a, b               []int
+	changedA, changedB []bool
+}
+
+// compare marks the changed lines between a[aLo:aHi] and b[bLo:bHi].
+func (m *myers) compare(aLo, aHi, bLo, bHi int) {
+	for aLo < aHi && bLo < bHi && m.a[aLo] == m.b[bLo] {
+		aLo++
+		bLo++
+	}
+	for aLo < aHi && bLo < bHi && m.a[aHi-1] == m.b[bHi-1] {
+		aHi--
+		bHi--
+	}
+
+	if aLo == aHi || bLo == bHi {
+		m.markChanged(aLo, aHi, bLo, bHi)
+		return
+	}
+
+	x, y, ok := m.middleSnake(aLo, aHi, bLo, bHi)
+	if !ok {
+		m.markChanged(aLo, aHi, bLo, bHi)
+		return
+	}
+
+	m.compare(aLo, x, bLo, y)
+	m.compare(x, aHi, y, bHi)
+}
+
+func (m *myers) markChanged(aLo, aHi, bLo, bHi int) {
+	for i := aLo; i < aHi; i++ {
+		m.changedA[i] = true
+	}
+	for j := bLo; j < bHi; j++ {
+		m.changedB[j] = true
+	}
+}
+
+// middleSnake runs the forward and backward searches simultaneously until they overlap,
+// and returns a point of the optimal edit path where the range can be split in two.
+// It reports false when the ranges share nothing or the search exceeds myersMaxCost.
+func (m *myers) middleSnake(aLo, aHi, bLo, bHi int) (int, int, bool) {
+	n, k := aHi-aLo, bHi-bLo
+	maxD := (n + k + 1) / 2
+	offset := maxD
+	size := 2*maxD + 2
+
+	forward := make([]int, size)
+	backward := make([]int, size)
+	for i := range forward {
+		forward[i] = -1
+		backward[i] = -1
+	}
+	forward[offset+1] = 0
+	backward[offset+1] = 0
+
+	delta := n - k
+	odd := delta%2 != 0
+
+	// Diagonals that ran off the edge of the grid are trimmed from later rounds
+	fStart, fEnd, bStart, bEnd := 0, 0, 0, 0
+
+	for d := 0; d < maxD && d < myersMaxCost; d++ {
+		for diag := -d + fStart; diag <= d-fEnd; diag += 2 {
+			i := offset + diag
+			var x int
+			if diag == -d || (diag != d && forward[i-1] < forward[i+1]) {
+				x = forward[i+1]
+			} else {
+				x = forward[i-1] + 1
+			}
+			y := x - diag
+			for x < n && y < k && m.a[aLo+x] == m.b[bLo+y] {
+				x++
+				y++
+			}
+			forward[i] = x
+
+			switch {
+			case x > n:
+				fEnd += 2
+			case y > k:
+				fStart += 2
+			case odd:
+				j := offset + delta - diag
+				if j >= 0 && j < size && backward[j] != -1 && x >= n-backward[j] {
+					return aLo + x, bLo + y, true
+				}
+			}
+		}
+
+		for diag := -d + bStart; diag <= d-bEnd; diag += 2 {
+			i := offset + diag
+			var x int
+			if diag == -d || (diag != d && backward[i-1] < backward[i+1]) {
+				x = backward[i+1]
+			} else {
+				x = backward[i-1] + 1
+			}
+			y := x - diag
+			for x < n && y < k && m.a[aHi-x-1] == m.b[bHi-y-1] {
+				x++
+				y++
+			}
+			backward[i] = x
+
+			switch {
+			case x > n:
+				bEnd += 2
+			case y > k:
+				bStart += 2
+			case !odd:
+				j := offset + delta - diag
+				if j >= 0 && j < size && forward[j] != -1 {
+					fx := forward[j]
+					fy := fx - (j - offset)
+					if fx >= n-x {
+						return aLo + fx, bLo + fy, true
+					}
+				}
+			}
+		}
+	}
+
+	return 0, 0, false
+}
@@ -0,0 +1,133 @@
+package tools
+
+import (
+	"math/rand"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestMyersDiff(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+	}{
+		{name: "both empty", a: "", b: ""},
+		{name: "insert into empty", a: "", b: "x y z"},
+		{name: "delete everything", a: "x y z", b: ""},
+		{name: "identical", a: "a b c d", b: "a b c d"},
+		{name: "append", a: "a b", b: "a b c"},
+		{name: "prepend", a: "b c", b: "a b c"},
+		{name: "replace middle", a: "a b c", b: "a x c"},
+		{name: "disjoint", a: "a b c", b: "x y z"},
+		{name: "paper example", a: "a b c a b b a", b: "c b a b a c"},
+		{name: "repeated lines", a: "x x x y x x", b: "x y x x x x"},
+		{name: "move block", a: "a b c d e f", b: "d e f a b c"},
+		{name: "interleaved", a: "a 1 b 2 c 3", b: "1 a 2 b 3 c"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkMyersDiff(t, strings.Fields(tt.a), strings.Fields(tt.b), true)
+		})
+	}
+}
+
+// TestMyersDiffRandom compares the diff of random inputs over a small alphabet, which
+// produces many repeated lines, with the longest common subsequence found by brute force.
+func TestMyersDiffRandom(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	random := func() []string {
+		lines := make([]string, rng.Intn(40))
+		for i := range lines {
+			lines[i] = string(rune('a' + rng.Intn(4)))
+		}
+		return lines
+	}
+
+	for i := 0; i < 500; i++ {
+		checkMyersDiff(t, random(), random(), true)
+	}
+}
+
+// TestMyersDiffCostLimit diffs inputs different enough to exceed myersMaxCost, where the
+// result may no longer be minimal but must still be a valid edit script.
+func TestMyersDiffCostLimit(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	random := func() []string {
+		lines := make([]string, 20000)
+		for i := range lines {
+			lines[i] = string(rune('a' + rng.Intn(16)))
+		}
+		return lines
+	}
+
+	checkMyersDiff(t, random(), random(), false)
+}
+
+// checkMyersDiff verifies that the unchanged lines of a and b form a common subsequence,
+// that it is a longest one when minimal is set, and that the edit script turns a into b.
+func checkMyersDiff(t *testing.T, a, b []string, minimal bool) {
+	t.Helper()
+
+	changedA, changedB := myersDiff(a, b)
+	if len(changedA) != len(a) || len(changedB) != len(b) {
+		t.Fatalf("diff of %q and %q: got %d and %d marks", a, b, len(changedA), len(changedB))
+	}
+
+	var keptA, keptB []string
+	for i, changed := range changedA {
+		if !changed {
+			keptA = append(keptA, a[i])
+		}
+	}
+	for i, changed := range changedB {
+		if !changed {
+			keptB = append(keptB, b[i])
+		}
+	}
+	if !slices.Equal(keptA, keptB) {
+		t.Fatalf("diff of %q and %q: unchanged lines differ: %q and %q", a, b, keptA, keptB)
+	}
+	if minimal {
+		if want := lcsLength(a, b); len(keptA) != want {
+			t.Fatalf("diff of %q and %q: kept %d lines, the longest common subsequence has %d", a, b, len(keptA), want)
+		}
+	}
+
+	// Dropping the changed lines of a and inserting those of b must give b back
+	var rebuilt []string
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && changedA[i]:
+			i++
+		case j < len(b) && changedB[j]:
+			rebuilt = append(rebuilt, b[j])
+			j++
+		default:
+			rebuilt = append(rebuilt, a[i])
+			i++
+			j++
+		}
+	}
+	if !slices.Equal(rebuilt, b) {
+		t.Fatalf("diff of %q and %q: applying it gives %q", a, b, rebuilt)
+	}
+}
+
+func lcsLength(a, b []string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for i := 1; i <= len(a); i++ {
+		for j := 1; j <= len(b); j++ {
+			if a[i-1] == b[j-1] {
+				cur[j] = prev[j-1] + 1
+			} else {
+				cur[j] = max(prev[j], cur[j-1])
+			}
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
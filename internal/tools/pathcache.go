@@ -0,0 +1,239 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	//
+	"mcp-forge/internal/index"
+
+	//
+	"github.com/fsnotify/fsnotify"
+)
+
+const (
+	// pathCacheMaxRoots bounds how many directory trees are cached (and watched) at once
+	pathCacheMaxRoots = 8
+
+	// pathCacheMaxAge forces a periodic rebuild in case notifications were missed
+	pathCacheMaxAge = 10 * time.Minute
+
+	// pathCacheDegradedMaxAge replaces pathCacheMaxAge for trees that could not be watched
+	// entirely, e.g. when the inotify watch limit was reached
+	pathCacheDegradedMaxAge = 30 * time.Second
+
+	// pathCacheMaxFiles caps the number of paths collected for a single tree
+	pathCacheMaxFiles = 500000
+)
+
+// cachedTree is the file list of one directory tree. The shared filesystem watcher marks
+// it stale whenever an entry is created, removed or renamed below the root.
+type cachedTree struct {
+	paths    []string
+	builtAt  time.Time
+	lastUsed time.Time
+	stale    atomic.Bool
+
+	// degraded is set when some directories could not be watched, so changes to them
+	// are only picked up by the next rebuild
+	degraded bool
+
+	watcher *index.Watcher
+	dirs    []string
+	stop    func()
+}
+
+// pathBuild is a tree being built. Callers asking for the same tree meanwhile wait for it
+// instead of walking the disk again.
+type pathBuild struct {
+	done chan struct{}
+	tree *cachedTree
+	err  error
+}
+
+// pathCache keeps the file lists used by find_file, so repeated queries on the same
+// tree do not walk the disk again.
+type pathCache struct {
+	watcher *index.Watcher
+
+	mu       sync.Mutex
+	trees    map[string]*cachedTree
+	building map[string]*pathBuild
+}
+
+func newPathCache(watcher *index.Watcher) *pathCache {
+	return &pathCache{
+		watcher:  watcher,
+		trees:    make(map[string]*cachedTree),
+		building: make(map[string]*pathBuild),
+	}
+}
+
+// Paths returns every file below root, in lexical order, honoring ignore files when
+// gitignore is set. The list is rebuilt only when the tree changed or got too old.
+// Degraded reports that part of the tree is not watched, so the list may be up to
+// pathCacheDegradedMaxAge behind the disk.
+func (c *pathCache) Paths(ctx context.Context, root string, gitignore bool) (paths []string, degraded bool, err error) {
+	key := root
+	if gitignore {
+		key += "\x00gitignore"
+	}
+
+	for {
+		c.mu.Lock()
+		if tree, ok := c.trees[key]; ok && tree.fresh() {
+			tree.lastUsed = time.Now()
+			c.mu.Unlock()
+			return tree.paths, tree.degraded, nil
+		}
+
+		// Builds run outside the lock, so a cold tree only delays the callers that need it
+		build, ok := c.building[key]
+		if !ok {
+			build = &pathBuild{done: make(chan struct{})}
+			c.building[key] = build
+			c.mu.Unlock()
+			c.build(ctx, key, root, gitignore, build)
+		} else {
+			c.mu.Unlock()
+		}
+
+		select {
+		case <-build.done:
+		case <-ctx.Done():
+			return nil, false, ctx.Err()
+		}
+
+		if build.err == nil {
+			return build.tree.paths, build.tree.degraded, nil
+		}
+		// A build cancelled by the caller that started it is retried by the others
+		if ctx.Err() != nil || !(errors.Is(build.err, context.Canceled) || errors.Is(build.err, context.DeadlineExceeded)) {
+			return nil, false, build.err
+		}
+	}
+}
+
+func (c *pathCache) build(ctx context.Context, key, root string, gitignore bool, build *pathBuild) {
+	tree, err := buildCachedTree(ctx, c.watcher, root, gitignore)
+
+	c.mu.Lock()
+	delete(c.building, key)
+	if err == nil {
+		// The old tree is released only now, so its directories stay watched meanwhile
+		if old, ok := c.trees[key]; ok {
+			old.close()
+			delete(c.trees, key)
+		} else if len(c.trees) >= pathCacheMaxRoots {
+			c.evictOldest()
+		}
+		c.trees[key] = tree
+	}
+	build.tree, build.err = tree, err
+	c.mu.Unlock()
+
+	close(build.done)
+}
+
+func (c *pathCache) evictOldest() {
+	oldestKey := ""
+	var oldest time.Time
+	for key, tree := range c.trees {
+		if oldestKey == "" || tree.lastUsed.Before(oldest) {
+			oldestKey = key
+			oldest = tree.lastUsed
+		}
+	}
+	if oldestKey != "" {
+		c.trees[oldestKey].close()
+		delete(c.trees, oldestKey)
+	}
+}
+
+func buildCachedTree(ctx context.Context, watcher *index.Watcher, root string, gitignore bool) (*cachedTree, error) {
+	tree := &cachedTree{
+		builtAt:  time.Now(),
+		lastUsed: time.Now(),
+		watcher:  watcher,
+	}
+
+	// Listening starts before the walk so that changes made during it are not missed
+	tree.stop = watcher.Listen(root, tree.notify, func(error) {
+		// A dropped event means the listing can no longer be trusted
+		tree.stale.Store(true)
+	})
+
+	var ignore *ignoreMatcher
+	if gitignore {
+		ignore = newIgnoreMatcher(root)
+	}
+
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+
+		if err != nil {
+			return nil
+		}
+
+		if path != root && (d.Name() == ".git" || (ignore != nil && ignore.Ignored(path, d.IsDir()))) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if d.IsDir() {
+			if err := watcher.Add(path); err != nil {
+				tree.degraded = true
+			} else {
+				tree.dirs = append(tree.dirs, path)
+			}
+			return nil
+		}
+
+		if len(tree.paths) >= pathCacheMaxFiles {
+			return filepath.SkipAll
+		}
+
+		tree.paths = append(tree.paths, path)
+		return nil
+	})
+	if err != nil {
+		tree.close()
+		return nil, err
+	}
+
+	sort.Strings(tree.paths)
+	return tree, nil
+}
+
+// notify marks the tree stale on any change to its set of paths. Plain writes to existing
+// files do not change the listing and are ignored.
+func (t *cachedTree) notify(event fsnotify.Event) {
+	if event.Op&(fsnotify.Create|fsnotify.Remove|fsnotify.Rename) != 0 {
+		t.stale.Store(true)
+	}
+}
+
+func (t *cachedTree) fresh() bool {
+	maxAge := pathCacheMaxAge
+	if t.degraded {
+		maxAge = pathCacheDegradedMaxAge
+	}
+	return !t.stale.Load() && time.Since(t.builtAt) < maxAge
+}
+
+func (t *cachedTree) close() {
+	t.stop()
+	for _, dir := range t.dirs {
+		t.watcher.Remove(dir)
+	}
+}
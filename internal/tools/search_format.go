@@ -0,0 +1,122 @@
+package tools
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Output modes of the search tool. Content is the original JSON list of matches;
+// the others render compact text meant to spend as few tokens as possible.
+const (
+	searchOutputContent = "content"
+	searchOutputFiles   = "files_with_matches"
+	searchOutputCount   = "count"
+	searchOutputGrouped = "grouped"
+)
+
+// searchFileGroup holds the consecutive matches found in a single file.
+type searchFileGroup struct {
+	File    string
+	Matches []searchMatch
+}
+
+// groupSearchMatches splits matches, which arrive in walk order, into one group per file.
+func groupSearchMatches(matches []searchMatch) []searchFileGroup {
+	var groups []searchFileGroup
+	for _, m := range matches {
+		if len(groups) == 0 || groups[len(groups)-1].File != m.File {
+			groups = append(groups, searchFileGroup{File: m.File})
+		}
+		last := &groups[len(groups)-1]
+		last.Matches = append(last.Matches, m)
+	}
+	return groups
+}
+
+// formatSearchText renders groups in one of the text output modes:
+//
+//	files_with_matches  one path per line
+//	count               path:matches per line
+//	grouped             a path header followed by "line: content" rows, grep style:
+//	                    context rows use "line- content" and "--" separates distant hunks
+//
+// A truncated result ends with the cursor to request the next page, and a result that left
+// files out says how many.
+func formatSearchText(mode string, groups []searchFileGroup, nextCursor string, skipped searchSkipped) string {
+	var sb strings.Builder
+	if len(groups) == 0 {
+		sb.WriteString("no matches\n")
+	}
+
+	for i, group := range groups {
+		switch mode {
+		case searchOutputFiles:
+			sb.WriteString(group.File)
+			sb.WriteByte('\n')
+
+		case searchOutputCount:
+			fmt.Fprintf(&sb, "%s:%d\n", group.File, len(group.Matches))
+
+		case searchOutputGrouped:
+			if i > 0 {
+				sb.WriteByte('\n')
+			}
+			sb.WriteString(group.File)
+			sb.WriteByte('\n')
+			writeGroupedRows(&sb, group.Matches)
+		}
+	}
+
+	if nextCursor != "" {
+		fmt.Fprintf(&sb, "\n[truncated] next_cursor: %s\n", nextCursor)
+	}
+	if !skipped.empty() {
+		fmt.Fprintf(&sb, "\n%s\n", skipped.String())
+	}
+
+	return strings.TrimSuffix(sb.String(), "\n")
+}
+
+// writeGroupedRows writes the matched and context lines of one file in line order,
+// printing each line once even when the context of neighbouring matches overlaps.
+// A line that is both context and a match is printed as a match.
+func writeGroupedRows(sb *strings.Builder, matches []searchMatch) {
+	type groupedRow struct {
+		sep  string
+		text string
+	}
+	rows := make(map[int]groupedRow)
+
+	// Context lines come formatted as "line: text" from the scanners
+	addContext := func(lines []string) {
+		for _, numbered := range lines {
+			num, text, ok := strings.Cut(numbered, ": ")
+			line, err := strconv.Atoi(num)
+			if !ok || err != nil {
+				continue
+			}
+			if _, seen := rows[line]; !seen {
+				rows[line] = groupedRow{sep: "-", text: text}
+			}
+		}
+	}
+
+	for _, m := range matches {
+		addContext(m.ContextBefore)
+		addContext(m.ContextAfter)
+		for i, text := range strings.Split(m.Content, "\n") {
+			rows[m.Line+i] = groupedRow{sep: ":", text: text}
+		}
+	}
+
+	lines := slices.Sorted(maps.Keys(rows))
+	for i, line := range lines {
+		if i > 0 && line > lines[i-1]+1 {
+			sb.WriteString("--\n")
+		}
+		fmt.Fprintf(sb, "%d%s %s\n", line, rows[line].sep, rows[line].text)
+	}
+}
@@ -0,0 +1,94 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	//
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+func (tm *ToolsManager) HandleCheckpoint(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	args := request.GetArguments()
+
+	action, ok := args["action"].(string)
+	if !ok || action == "" {
+		return toolError("action parameter is required"), nil
+	}
+
+	name, _ := args["name"].(string)
+	if action != "list" && name == "" {
+		return toolError("name parameter is required for action " + action), nil
+	}
+
+	undo := tm.dependencies.Undo
+
+	switch action {
+	case "create":
+		if err := undo.CreateCheckpoint(name, undoOriginFromCtx(ctx, "checkpoint")); err != nil {
+			return toolError(err.Error()), nil
+		}
+		return toolSuccess(fmt.Sprintf("Created checkpoint %q. Files changed through the tools from now on can be rolled back to their current state", name)), nil
+
+	case "list":
+		// Checkpoints of other sessions are only listed to callers who may roll them back
+		checkpoints := undo.Checkpoints(undoOriginFromCtx(ctx, "checkpoint"), func(files []string) bool {
+			return tm.undoOverride(ctx, files)
+		})
+
+		jsonBytes, err := json.MarshalIndent(checkpoints, "", "  ")
+		if err != nil {
+			return toolError(fmt.Sprintf("failed to marshal results: %s", err.Error())), nil
+		}
+		return toolSuccess(string(jsonBytes)), nil
+
+	case "rollback":
+		// Every file the rollback would write must be writable before anything is touched
+		files, err := undo.CheckpointFiles(name, undoOriginFromCtx(ctx, "checkpoint"))
+		if err != nil {
+			return toolError(err.Error()), nil
+		}
+		if err := tm.dependencies.RBAC.Check("checkpoint", files, jwtPayloadFromCtx(ctx)); err != nil {
+			return toolError(err.Error()), nil
+		}
+
+		results, err := undo.Rollback(name, undoOriginFromCtx(ctx, "checkpoint"), tm.undoOverride(ctx, files))
+		if err != nil {
+			return toolError(err.Error()), nil
+		}
+
+		failed := 0
+		for _, r := range results {
+			if r.Error != "" {
+				failed++
+			}
+		}
+
+		jsonBytes, err := json.MarshalIndent(map[string]interface{}{
+			"checkpoint": name,
+			"files":      results,
+			"failed":     failed,
+		}, "", "  ")
+		if err != nil {
+			return toolError(fmt.Sprintf("failed to marshal results: %s", err.Error())), nil
+		}
+		if failed > 0 {
+			return toolError(string(jsonBytes)), nil
+		}
+		return toolSuccess(string(jsonBytes)), nil
+
+	case "delete":
+		files, err := undo.CheckpointFiles(name, undoOriginFromCtx(ctx, "checkpoint"))
+		if err != nil {
+			return toolError(err.Error()), nil
+		}
+		if err := undo.DeleteCheckpoint(name, undoOriginFromCtx(ctx, "checkpoint"), tm.undoOverride(ctx, files)); err != nil {
+			return toolError(err.Error()), nil
+		}
+		return toolSuccess(fmt.Sprintf("Deleted checkpoint %q", name)), nil
+
+	default:
+		return toolError(fmt.Sprintf("unknown action %q (valid: create, list, rollback, delete)", action)), nil
+	}
+}
@@ -3,6 +3,7 @@ package tools
 import (
 	"bufio"
 	"context"
+	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -24,13 +25,37 @@ func (tm *ToolsManager) HandleDiff(ctx context.Context, request mcp.CallToolRequ
 		return toolError(err.Error()), nil
 	}
 
-	pathB, ok := args["path_b"].(string)
-	if !ok || pathB == "" {
-		return toolError("path_b parameter is required"), nil
+	pathB, _ := args["path_b"].(string)
+	contentB, hasContentB := args["content_b"].(string)
+	against, _ := args["against"].(string)
+
+	sources := 0
+	for _, given := range []bool{pathB != "", hasContentB, against != ""} {
+		if given {
+			sources++
+		}
+	}
+	if sources != 1 {
+		return toolError("exactly one of path_b, content_b or against is required"), nil
+	}
+	if against != "" && against != "undo" {
+		return toolError(fmt.Sprintf("unknown against %q (valid: undo)", against)), nil
 	}
 
-	if err := sanitizePath(pathB); err != nil {
-		return toolError(err.Error()), nil
+	format := "unified"
+	if v, ok := args["format"].(string); ok && v != "" {
+		if v != "unified" && v != "json" {
+			return toolError(fmt.Sprintf("unknown format %q (valid: unified, json)", v)), nil
+		}
+		format = v
+	}
+
+	granularity := diffGranularityLine
+	if v, ok := args["granularity"].(string); ok && v != "" {
+		if v != diffGranularityLine && v != diffGranularityWord && v != diffGranularityChar {
+			return toolError(fmt.Sprintf("unknown granularity %q (valid: line, word, char)", v)), nil
+		}
+		granularity = v
 	}
 
 	absPathA, err := filepath.Abs(pathA)
@@ -38,66 +63,224 @@ func (tm *ToolsManager) HandleDiff(ctx context.Context, request mcp.CallToolRequ
 		return toolError(fmt.Sprintf("invalid path_a: %s", err.Error())), nil
 	}
 
-	absPathB, err := filepath.Abs(pathB)
-	if err != nil {
-		return toolError(fmt.Sprintf("invalid path_b: %s", err.Error())), nil
+	checked := []string{absPathA}
+	absPathB := ""
+	if pathB != "" {
+		if err := sanitizePath(pathB); err != nil {
+			return toolError(err.Error()), nil
+		}
+
+		absPathB, err = filepath.Abs(pathB)
+		if err != nil {
+			return toolError(fmt.Sprintf("invalid path_b: %s", err.Error())), nil
+		}
+		checked = append(checked, absPathB)
 	}
 
-	if err := tm.dependencies.RBAC.Check("diff", []string{absPathA, absPathB}, jwtPayloadFromCtx(ctx)); err != nil {
+	if err := tm.dependencies.RBAC.Check("diff", checked, jwtPayloadFromCtx(ctx)); err != nil {
 		return toolError(err.Error()), nil
 	}
 
-	linesA, err := readLines(absPathA)
-	if err != nil {
-		return toolError(fmt.Sprintf("failed to read %s: %s", absPathA, err.Error())), nil
+	infoA, err := os.Stat(absPathA)
+	if err != nil && (against == "" || !os.IsNotExist(err)) {
+		return toolError(fmt.Sprintf("failed to stat %s: %s", absPathA, err.Error())), nil
 	}
 
-	linesB, err := readLines(absPathB)
-	if err != nil {
-		return toolError(fmt.Sprintf("failed to read %s: %s", absPathB, err.Error())), nil
+	if absPathB != "" {
+		infoB, err := os.Stat(absPathB)
+		if err != nil {
+			return toolError(fmt.Sprintf("failed to stat %s: %s", absPathB, err.Error())), nil
+		}
+
+		if infoA.IsDir() != infoB.IsDir() {
+			return toolError("path_a and path_b must both be files or both be directories"), nil
+		}
+
+		if infoA.IsDir() {
+			return tm.diffDirectories(ctx, absPathA, absPathB, args)
+		}
+	} else if infoA != nil && infoA.IsDir() {
+		return toolError("path_a must be a file when comparing with content_b or against undo"), nil
 	}
 
-	startA := 0
-	if v, ok := args["start_a"].(float64); ok {
-		startA = int(v)
+	var linesA, linesB []string
+	labelA, labelB := absPathA, absPathB
+
+	switch {
+	case against == "undo":
+		// The snapshot is the old side, so the diff reads as the changes made since
+		content, existed, err := tm.dependencies.Undo.Snapshot(absPathA, undoOriginFromCtx(ctx, "diff"), tm.undoOverride(ctx, []string{absPathA}))
+		if err != nil {
+			return toolError(err.Error()), nil
+		}
+		if existed {
+			linesA = splitLines(string(content))
+		}
+		labelA = absPathA + " (undo snapshot)"
+
+		// A file deleted since the snapshot compares against empty content
+		if infoA != nil {
+			linesB, err = readLines(absPathA)
+			if err != nil {
+				return toolError(fmt.Sprintf("failed to read %s: %s", absPathA, err.Error())), nil
+			}
+		}
+		labelB = absPathA
+
+	default:
+		linesA, err = readLines(absPathA)
+		if err != nil {
+			return toolError(fmt.Sprintf("failed to read %s: %s", absPathA, err.Error())), nil
+		}
+
+		if hasContentB {
+			linesB = splitLines(contentB)
+			labelB = "content_b"
+		} else {
+			linesB, err = readLines(absPathB)
+			if err != nil {
+				return toolError(fmt.Sprintf("failed to read %s: %s", absPathB, err.Error())), nil
+			}
+		}
 	}
-	endA := len(linesA)
-	if v, ok := args["end_a"].(float64); ok {
-		endA = int(v)
+
+	startA, endA := diffRange(args, "start_a", "end_a", len(linesA))
+	startB, endB := diffRange(args, "start_b", "end_b", len(linesB))
+
+	sliceA := linesA[startA:endA]
+	sliceB := linesB[startB:endB]
+
+	hunks := diffHunks(sliceA, sliceB, startA, startB, diffContextLines(args))
+
+	if format == "json" {
+		return diffJSON(labelA, labelB, hunks, granularity)
 	}
 
-	startB := 0
-	if v, ok := args["start_b"].(float64); ok {
-		startB = int(v)
+	if len(hunks) == 0 {
+		return toolSuccess("Files are identical (in the specified ranges)"), nil
 	}
-	endB := len(linesB)
-	if v, ok := args["end_b"].(float64); ok {
-		endB = int(v)
+
+	if granularity != diffGranularityLine {
+		return toolSuccess(formatInlineDiff(labelA, labelB, hunks, granularity)), nil
 	}
 
-	if startA < 0 {
-		startA = 0
+	return toolSuccess(formatUnifiedDiff(labelA, labelB, hunks)), nil
+}
+
+// diffRange reads the 0-based, end-exclusive line range of one side from args, clamped
+// to the n lines available so that any input yields a valid slice.
+func diffRange(args map[string]interface{}, startKey, endKey string, n int) (start, end int) {
+	end = n
+	if v, ok := args[startKey].(float64); ok {
+		start = int(v)
 	}
-	if endA > len(linesA) {
-		endA = len(linesA)
+	if v, ok := args[endKey].(float64); ok {
+		end = int(v)
 	}
-	if startB < 0 {
-		startB = 0
+
+	end = max(0, min(end, n))
+	start = max(0, min(start, end))
+	return start, end
+}
+
+type diffJSONLine struct {
+	Op      string `json:"op"`
+	Text    string `json:"text"`
+	OldLine *int   `json:"old_line,omitempty"`
+	NewLine *int   `json:"new_line,omitempty"`
+}
+
+type diffJSONHunk struct {
+	OldStart int            `json:"old_start"`
+	OldCount int            `json:"old_count"`
+	NewStart int            `json:"new_start"`
+	NewCount int            `json:"new_count"`
+	Lines    []diffJSONLine `json:"lines"`
+	Inline   []string       `json:"inline,omitempty"`
+}
+
+// diffJSON returns hunks as structured objects. All line numbers are 0-based; op is
+// "=" for context, "-" for removed and "+" for added lines.
+func diffJSON(pathA, pathB string, hunks []diffHunk, granularity string) (*mcp.CallToolResult, error) {
+	out := make([]diffJSONHunk, 0, len(hunks))
+	for _, hunk := range hunks {
+		h := diffJSONHunk{
+			OldStart: hunk.StartA,
+			OldCount: hunk.CountA,
+			NewStart: hunk.StartB,
+			NewCount: hunk.CountB,
+			Lines:    make([]diffJSONLine, 0, len(hunk.Lines)),
+		}
+		for _, line := range hunk.Lines {
+			l := diffJSONLine{Op: "=", Text: line.Text}
+			if line.Op != ' ' {
+				l.Op = string(line.Op)
+			}
+			if line.NumA >= 0 {
+				l.OldLine = &line.NumA
+			}
+			if line.NumB >= 0 {
+				l.NewLine = &line.NumB
+			}
+			h.Lines = append(h.Lines, l)
+		}
+		if granularity != diffGranularityLine {
+			h.Inline = inlineHunkLines(hunk, granularity)
+		}
+		out = append(out, h)
 	}
-	if endB > len(linesB) {
-		endB = len(linesB)
+
+	jsonBytes, err := json.MarshalIndent(map[string]interface{}{
+		"path_a":    pathA,
+		"path_b":    pathB,
+		"identical": len(hunks) == 0,
+		"hunks":     out,
+	}, "", "  ")
+	if err != nil {
+		return toolError(fmt.Sprintf("failed to marshal results: %s", err.Error())), nil
 	}
 
-	sliceA := linesA[startA:endA]
-	sliceB := linesB[startB:endB]
+	return toolSuccess(string(jsonBytes)), nil
+}
+
+// diffDirectories reports the files added, removed and changed between two directory trees.
+func (tm *ToolsManager) diffDirectories(ctx context.Context, rootA, rootB string, args map[string]interface{}) (*mcp.CallToolResult, error) {
+	opts := searchOptions{
+		contextLines: diffContextLines(args),
+		maxFileSize:  searchDefaultMaxFileSize,
+		gitignore:    true,
+	}
+	if v, ok := args["include"].(string); ok {
+		opts.include = v
+	}
+	if v, ok := args["exclude"].(string); ok {
+		opts.exclude = v
+	}
+	if v, ok := args["gitignore"].(bool); ok {
+		opts.gitignore = v
+	}
+	if v, ok := args["max_file_size"].(float64); ok && v > 0 {
+		opts.maxFileSize = int64(v)
+	}
 
-	diff := computeDiff(absPathA, absPathB, sliceA, sliceB, startA, startB)
+	result, err := diffDirs(ctx, rootA, rootB, opts)
+	if err != nil {
+		return toolError(fmt.Sprintf("diff error: %s", err.Error())), nil
+	}
 
-	if diff == "" {
-		return toolSuccess("Files are identical (in the specified ranges)"), nil
+	jsonBytes, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return toolError(fmt.Sprintf("failed to marshal results: %s", err.Error())), nil
 	}
 
-	return toolSuccess(diff), nil
+	return toolSuccess(string(jsonBytes)), nil
+}
+
+func diffContextLines(args map[string]interface{}) int {
+	if v, ok := args["context_lines"].(float64); ok && v >= 0 {
+		return int(v)
+	}
+	return diffDefaultContext
 }
 
 func readLines(path string) ([]string, error) {
@@ -116,73 +299,164 @@ func readLines(path string) ([]string, error) {
 	return lines, scanner.Err()
 }
 
-func computeDiff(pathA, pathB string, linesA, linesB []string, offsetA, offsetB int) string {
-	var sb strings.Builder
+// diffDefaultContext is the number of unchanged lines shown around each change.
+const diffDefaultContext = 3
 
-	fmt.Fprintf(&sb, "--- %s\n", pathA)
-	fmt.Fprintf(&sb, "+++ %s\n", pathB)
+// diffLine is one line of a hunk. NumA and NumB are 0-based line numbers in the original
+// files, or -1 for the side the line does not exist on.
+type diffLine struct {
+	Op   byte
+	Text string
+	NumA int
+	NumB int
+}
 
-	m := len(linesA)
-	n := len(linesB)
-
-	table := make([][]int, m+1)
-	for i := range table {
-		table[i] = make([]int, n+1)
-	}
-	for i := 1; i <= m; i++ {
-		for j := 1; j <= n; j++ {
-			if linesA[i-1] == linesB[j-1] {
-				table[i][j] = table[i-1][j-1] + 1
-			} else if table[i-1][j] >= table[i][j-1] {
-				table[i][j] = table[i-1][j]
-			} else {
-				table[i][j] = table[i][j-1]
-			}
-		}
+// diffHunk is a group of changes with their surrounding context. Starts are 0-based; a
+// hunk with a zero count on one side inserts or deletes right before that start line.
+type diffHunk struct {
+	StartA int
+	CountA int
+	StartB int
+	CountB int
+	Lines  []diffLine
+}
+
+// computeDiff returns the unified diff of linesA and linesB with the given amount of
+// context, or an empty string when they are identical. The offsets are added to every
+// line number so that ranges of a file are reported at their real position.
+func computeDiff(pathA, pathB string, linesA, linesB []string, offsetA, offsetB, context int) string {
+	hunks := diffHunks(linesA, linesB, offsetA, offsetB, context)
+	if len(hunks) == 0 {
+		return ""
 	}
+	return formatUnifiedDiff(pathA, pathB, hunks)
+}
 
-	type diffLine struct {
-		op   byte
-		text string
-		numA int
-		numB int
+// diffHunks computes the edit script between linesA and linesB and groups it into hunks.
+// Changes separated by at most 2*context unchanged lines share a hunk.
+func diffHunks(linesA, linesB []string, offsetA, offsetB, context int) []diffHunk {
+	if context < 0 {
+		context = 0
 	}
 
-	var diffs []diffLine
-	i, j := m, n
-	for i > 0 || j > 0 {
-		if i > 0 && j > 0 && linesA[i-1] == linesB[j-1] {
-			diffs = append(diffs, diffLine{' ', linesA[i-1], offsetA + i - 1, offsetB + j - 1})
-			i--
-			j--
-		} else if j > 0 && (i == 0 || table[i][j-1] >= table[i-1][j]) {
-			diffs = append(diffs, diffLine{'+', linesB[j-1], -1, offsetB + j - 1})
-			j--
-		} else if i > 0 {
-			diffs = append(diffs, diffLine{'-', linesA[i-1], offsetA + i - 1, -1})
-			i--
+	changedA, changedB := myersDiff(linesA, linesB)
+
+	var script []diffLine
+	i, j := 0, 0
+	for i < len(linesA) || j < len(linesB) {
+		switch {
+		case i < len(linesA) && changedA[i]:
+			script = append(script, diffLine{'-', linesA[i], offsetA + i, -1})
+			i++
+		case j < len(linesB) && changedB[j]:
+			script = append(script, diffLine{'+', linesB[j], -1, offsetB + j})
+			j++
+		default:
+			script = append(script, diffLine{' ', linesA[i], offsetA + i, offsetB + j})
+			i++
+			j++
 		}
 	}
 
-	for left, right := 0, len(diffs)-1; left < right; left, right = left+1, right-1 {
-		diffs[left], diffs[right] = diffs[right], diffs[left]
+	// posA[k] and posB[k] are the line numbers reached on each side before script[k]
+	posA := make([]int, len(script)+1)
+	posB := make([]int, len(script)+1)
+	posA[0], posB[0] = offsetA, offsetB
+	for k, line := range script {
+		posA[k+1], posB[k+1] = posA[k], posB[k]
+		if line.NumA >= 0 {
+			posA[k+1]++
+		}
+		if line.NumB >= 0 {
+			posB[k+1]++
+		}
 	}
 
-	hasChanges := false
-	for _, d := range diffs {
-		if d.op != ' ' {
-			hasChanges = true
-			break
+	var hunks []diffHunk
+	for start := 0; start < len(script); {
+		if script[start].Op == ' ' {
+			start++
+			continue
 		}
+
+		// Extend the hunk while the next change is close enough to share its context
+		end := start
+		for k := start; k < len(script); k++ {
+			if script[k].Op != ' ' {
+				end = k + 1
+				continue
+			}
+			if k-end >= 2*context {
+				break
+			}
+		}
+
+		from := max(0, start-context)
+		to := min(len(script), end+context)
+		hunks = append(hunks, diffHunk{
+			StartA: posA[from],
+			CountA: posA[to] - posA[from],
+			StartB: posB[from],
+			CountB: posB[to] - posB[from],
+			Lines:  script[from:to],
+		})
+		start = to
 	}
 
-	if !hasChanges {
-		return ""
+	return hunks
+}
+
+// formatUnifiedDiff renders hunks in the unified format understood by patch. The @@
+// headers carry the usual 1-based ranges, followed by the same ranges as 0-based
+// half-open line intervals, the numbering read_file and the diff range arguments use.
+func formatUnifiedDiff(pathA, pathB string, hunks []diffHunk) string {
+	var sb strings.Builder
+
+	fmt.Fprintf(&sb, "--- %s\n", pathA)
+	fmt.Fprintf(&sb, "+++ %s\n", pathB)
+
+	for _, hunk := range hunks {
+		writeHunkHeader(&sb, hunk)
+		for _, line := range hunk.Lines {
+			sb.WriteByte(line.Op)
+			sb.WriteString(line.Text)
+			sb.WriteByte('\n')
+		}
 	}
 
-	for _, d := range diffs {
-		fmt.Fprintf(&sb, "%c %s\n", d.op, d.text)
+	return sb.String()
+}
+
+// formatInlineDiff renders hunks like formatUnifiedDiff, with replaced lines merged into
+// "~" lines carrying word or character level change markers.
+func formatInlineDiff(pathA, pathB string, hunks []diffHunk, granularity string) string {
+	var sb strings.Builder
+
+	fmt.Fprintf(&sb, "--- %s\n", pathA)
+	fmt.Fprintf(&sb, "+++ %s\n", pathB)
+
+	for _, hunk := range hunks {
+		writeHunkHeader(&sb, hunk)
+		for _, line := range inlineHunkLines(hunk, granularity) {
+			sb.WriteString(line)
+			sb.WriteByte('\n')
+		}
 	}
 
 	return sb.String()
 }
+
+func writeHunkHeader(sb *strings.Builder, hunk diffHunk) {
+	fmt.Fprintf(sb, "@@ -%s +%s @@ a[%d:%d] b[%d:%d]\n",
+		unifiedRange(hunk.StartA, hunk.CountA), unifiedRange(hunk.StartB, hunk.CountB),
+		hunk.StartA, hunk.StartA+hunk.CountA, hunk.StartB, hunk.StartB+hunk.CountB)
+}
+
+// unifiedRange formats a 0-based start and count as a 1-based unified diff range. An empty
+// range names the line after which the change applies, so it keeps the 0-based value.
+func unifiedRange(start, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	return fmt.Sprintf("%d,%d", start+1, count)
+}
@@ -0,0 +1,33 @@
+package tools
+
+import (
+	"testing"
+)
+
+func TestDiffRange(t *testing.T) {
+	tests := []struct {
+		name       string
+		args       map[string]interface{}
+		start, end int
+	}{
+		{name: "whole file", args: map[string]interface{}{}, start: 0, end: 10},
+		{name: "inner range", args: map[string]interface{}{"start_a": 2.0, "end_a": 5.0}, start: 2, end: 5},
+		{name: "end past the file", args: map[string]interface{}{"end_a": 50.0}, start: 0, end: 10},
+		{name: "negative start", args: map[string]interface{}{"start_a": -3.0, "end_a": 4.0}, start: 0, end: 4},
+		{name: "negative end", args: map[string]interface{}{"end_a": -1.0}, start: 0, end: 0},
+		{name: "negative end after start", args: map[string]interface{}{"start_a": 3.0, "end_a": -1.0}, start: 0, end: 0},
+		{name: "start after end", args: map[string]interface{}{"start_a": 8.0, "end_a": 4.0}, start: 4, end: 4},
+		{name: "start past the file", args: map[string]interface{}{"start_a": 20.0}, start: 10, end: 10},
+	}
+
+	lines := make([]string, 10)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start, end := diffRange(tt.args, "start_a", "end_a", len(lines))
+			if start != tt.start || end != tt.end {
+				t.Fatalf("got [%d:%d], want [%d:%d]", start, end, tt.start, tt.end)
+			}
+			_ = lines[start:end]
+		})
+	}
+}
@@ -69,7 +69,7 @@ func (tm *ToolsManager) HandleEditFile(ctx context.Context, request mcp.CallTool
 		return toolError(fmt.Sprintf("failed to read file: %s", err.Error())), nil
 	}
 
-	if err := tm.dependencies.Undo.Save(absPath); err != nil {
+	if err := tm.dependencies.Undo.Save(absPath, undoOriginFromCtx(ctx, "edit_file")); err != nil {
 		tm.dependencies.AppCtx.Logger.Error("failed to save undo state", "path", absPath, "error", err.Error())
 	}
 
@@ -54,6 +54,18 @@ func (tm *ToolsManager) HandleExec(ctx context.Context, request mcp.CallToolRequ
 		background = v
 	}
 
+	var snapshot *execSnapshot
+	if v, ok := args["snapshot"].(bool); ok && v {
+		if background {
+			return toolError("snapshot is not supported for background commands"), nil
+		}
+		var err error
+		snapshot, err = takeExecSnapshot(ctx, resolveExecPath(workdir))
+		if err != nil {
+			return toolError(fmt.Sprintf("failed to snapshot workdir: %s", err.Error())), nil
+		}
+	}
+
 	if background {
 		id, err := tm.dependencies.Processes.Start(command, workdir, env)
 		if err != nil {
@@ -70,8 +82,20 @@ func (tm *ToolsManager) HandleExec(ctx context.Context, request mcp.CallToolRequ
 	}
 
 	stdout, stderr, exitCode, err := tm.dependencies.Processes.Exec(command, workdir, env, timeout)
+
+	// A failed or timed out command may have changed files all the same
+	var changes *execChanges
+	if snapshot != nil {
+		changes = tm.recordExecChanges(ctx, snapshot)
+	}
+
 	if err != nil {
-		return toolError(fmt.Sprintf("command failed: %s\nstdout: %s\nstderr: %s", err.Error(), stdout, stderr)), nil
+		message := fmt.Sprintf("command failed: %s\nstdout: %s\nstderr: %s", err.Error(), stdout, stderr)
+		if changes != nil {
+			changesJSON, _ := json.MarshalIndent(changes, "", "  ")
+			message += "\nchanges: " + string(changesJSON)
+		}
+		return toolError(message), nil
 	}
 
 	result := map[string]interface{}{
@@ -79,6 +103,9 @@ func (tm *ToolsManager) HandleExec(ctx context.Context, request mcp.CallToolRequ
 		"stdout":    stdout,
 		"stderr":    stderr,
 	}
+	if changes != nil {
+		result["changes"] = changes
+	}
 	jsonBytes, _ := json.MarshalIndent(result, "", "  ")
 
 	if exitCode != 0 {
@@ -0,0 +1,239 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+
+	//
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+const (
+	fuzzyScoreMatch       = 16
+	fuzzyBonusSegment     = 10
+	fuzzyBonusBoundary    = 8
+	fuzzyBonusCamel       = 7
+	fuzzyBonusConsecutive = 6
+	fuzzyBonusBasename    = 6
+	fuzzyPenaltyGap       = 1
+)
+
+type fileCandidate struct {
+	Path  string `json:"path"`
+	Score int    `json:"score"`
+}
+
+func (tm *ToolsManager) HandleFindFile(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	args := request.GetArguments()
+
+	query, ok := args["query"].(string)
+	if !ok || strings.TrimSpace(query) == "" {
+		return toolError("query parameter is required"), nil
+	}
+
+	searchPath, ok := args["path"].(string)
+	if !ok || searchPath == "" {
+		return toolError("path parameter is required"), nil
+	}
+
+	if err := sanitizePath(searchPath); err != nil {
+		return toolError(err.Error()), nil
+	}
+
+	absPath, err := filepath.Abs(searchPath)
+	if err != nil {
+		return toolError(fmt.Sprintf("invalid path: %s", err.Error())), nil
+	}
+
+	payload := jwtPayloadFromCtx(ctx)
+	if err := tm.dependencies.RBAC.Check("find_file", []string{absPath}, payload); err != nil {
+		return toolError(err.Error()), nil
+	}
+
+	maxResults := 20
+	if v, ok := args["max_results"].(float64); ok && v > 0 {
+		maxResults = int(v)
+	}
+
+	gitignore := true
+	if v, ok := args["gitignore"].(bool); ok {
+		gitignore = v
+	}
+
+	paths, degraded, err := tm.paths.Paths(ctx, absPath, gitignore)
+	if err != nil {
+		return toolError(fmt.Sprintf("failed to list files: %s", err.Error())), nil
+	}
+
+	// Files the caller may not read are left out before anything is counted, so that
+	// the totals do not reveal how many of them match
+	terms := strings.Fields(query)
+	var candidates []fileCandidate
+	searched := 0
+	for i, path := range paths {
+		if i%searchCtxCheckInterval == 0 {
+			if err := ctx.Err(); err != nil {
+				return toolError(fmt.Sprintf("find_file cancelled: %s", err.Error())), nil
+			}
+		}
+
+		rel, err := filepath.Rel(absPath, path)
+		if err != nil {
+			continue
+		}
+
+		if tm.dependencies.RBAC.Check("find_file", []string{path}, payload) != nil {
+			continue
+		}
+		searched++
+
+		if score, ok := fuzzyScorePath(filepath.ToSlash(rel), terms); ok {
+			candidates = append(candidates, fileCandidate{Path: path, Score: score})
+		}
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].Score != candidates[j].Score {
+			return candidates[i].Score > candidates[j].Score
+		}
+		if len(candidates[i].Path) != len(candidates[j].Path) {
+			return len(candidates[i].Path) < len(candidates[j].Path)
+		}
+		return candidates[i].Path < candidates[j].Path
+	})
+
+	results := candidates[:min(maxResults, len(candidates))]
+	if results == nil {
+		results = []fileCandidate{}
+	}
+
+	result := map[string]interface{}{
+		"results":        results,
+		"total_matches":  len(candidates),
+		"files_searched": searched,
+	}
+	if degraded {
+		result["note"] = fmt.Sprintf("part of this tree cannot be watched for changes, so files created or removed in the last %s may be missing", pathCacheDegradedMaxAge)
+	}
+
+	jsonBytes, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return toolError(fmt.Sprintf("failed to marshal results: %s", err.Error())), nil
+	}
+
+	return toolSuccess(string(jsonBytes)), nil
+}
+
+// fuzzyScorePath scores path against every term; all terms must match. Shorter paths
+// score slightly higher so that, all else equal, shallower files rank first.
+func fuzzyScorePath(path string, terms []string) (int, bool) {
+	total := 0
+	for _, term := range terms {
+		score, ok := fuzzyScore(path, term)
+		if !ok {
+			return 0, false
+		}
+		total += score
+	}
+	return total - len(path)/8, true
+}
+
+// fuzzyScore finds the best alignment of term as a subsequence of path, in the spirit of
+// fzf: matches at segment starts, word boundaries and camelCase humps, consecutive matches
+// and matches inside the basename earn bonuses, while gaps cost a small penalty.
+// Matching is case-insensitive unless term contains an uppercase letter.
+func fuzzyScore(path, term string) (int, bool) {
+	p := []rune(path)
+	t := []rune(term)
+	if len(t) == 0 {
+		return 0, true
+	}
+	if len(t) > len(p) {
+		return 0, false
+	}
+
+	caseSensitive := strings.IndexFunc(term, unicode.IsUpper) != -1
+	equal := func(a, b rune) bool {
+		if caseSensitive {
+			return a == b
+		}
+		return unicode.ToLower(a) == unicode.ToLower(b)
+	}
+
+	// Quick subsequence check before running the full alignment
+	k := 0
+	for _, r := range p {
+		if k < len(t) && equal(r, t[k]) {
+			k++
+		}
+	}
+	if k < len(t) {
+		return 0, false
+	}
+
+	baseStart := strings.LastIndex(path, "/") + 1
+	baseStartRune := len([]rune(path[:baseStart]))
+
+	bonus := make([]int, len(p))
+	for j := range p {
+		b := fuzzyScoreMatch
+		switch {
+		case j == 0 || p[j-1] == '/':
+			b += fuzzyBonusSegment
+		case strings.ContainsRune("_-. ", p[j-1]):
+			b += fuzzyBonusBoundary
+		case unicode.IsLower(p[j-1]) && unicode.IsUpper(p[j]):
+			b += fuzzyBonusCamel
+		}
+		if j >= baseStartRune {
+			b += fuzzyBonusBasename
+		}
+		bonus[j] = b
+	}
+
+	// prev[j] is the best score with the previous term rune matched at position j
+	const unmatched = math.MinInt / 2
+	prev := make([]int, len(p))
+	cur := make([]int, len(p))
+	for j := range p {
+		prev[j] = unmatched
+		if equal(p[j], t[0]) {
+			prev[j] = bonus[j]
+		}
+	}
+
+	for i := 1; i < len(t); i++ {
+		gapBest := unmatched
+		for j := range p {
+			cur[j] = unmatched
+			if j >= 2 && prev[j-2] > unmatched {
+				gapBest = max(gapBest, prev[j-2]) - fuzzyPenaltyGap
+			} else if gapBest > unmatched {
+				gapBest -= fuzzyPenaltyGap
+			}
+			if j == 0 || !equal(p[j], t[i]) {
+				continue
+			}
+			best := gapBest
+			if prev[j-1] > unmatched {
+				best = max(best, prev[j-1]+fuzzyBonusConsecutive)
+			}
+			if best > unmatched {
+				cur[j] = best + bonus[j]
+			}
+		}
+		prev, cur = cur, prev
+	}
+
+	best := unmatched
+	for _, s := range prev {
+		best = max(best, s)
+	}
+	return best, best > unmatched
+}
@@ -6,7 +6,12 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
+	"time"
+
+	//
+	"mcp-forge/internal/state"
 
 	//
 	"github.com/mark3labs/mcp-go/mcp"
@@ -20,11 +25,29 @@ type lsEntry struct {
 	Mode     string    `json:"mode"`
 	ModTime  string    `json:"mod_time"`
 	Children []lsEntry `json:"children,omitempty"`
+
+	// Continued marks a directory already returned by a previous page, repeated only
+	// to hold the entries of this page that live inside it
+	Continued bool `json:"continued,omitempty"`
+
+	// Omitted is set on the "more" placeholder that closes a directory cut by max_per_dir
+	Omitted int `json:"omitted,omitempty"`
 }
 
 func (tm *ToolsManager) HandleLs(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 	args := request.GetArguments()
 
+	// A cursor replays the original arguments and resumes after the last returned entry
+	var resume *state.Cursor
+	if token, _ := args["cursor"].(string); token != "" {
+		cursor, err := tm.dependencies.Cursors.Get(token, sessionIDFromCtx(ctx), "ls")
+		if err != nil {
+			return toolError(err.Error()), nil
+		}
+		args = cursor.Args
+		resume = cursor
+	}
+
 	path, ok := args["path"].(string)
 	if !ok || path == "" {
 		return toolError("path parameter is required"), nil
@@ -58,12 +81,94 @@ func (tm *ToolsManager) HandleLs(ctx context.Context, request mcp.CallToolReques
 		includeHidden = h
 	}
 
-	entries, err := listDir(absPath, depth, 0, pattern, includeHidden)
+	// Pagination is opt-in, so that listings without a limit keep the plain array shape
+	limit := 0
+	if v, ok := args["limit"].(float64); ok && v > 0 {
+		limit = int(v)
+	}
+
+	sortBy := "name"
+	if v, ok := args["sort"].(string); ok && v != "" {
+		if !lsSortKeys[v] {
+			return toolError(fmt.Sprintf("unknown sort %q (valid: name, size, mtime, type)", v)), nil
+		}
+		sortBy = v
+	}
+
+	reverse := false
+	if v, ok := args["reverse"].(bool); ok {
+		reverse = v
+	}
+
+	dirsFirst := false
+	if v, ok := args["dirs_first"].(bool); ok {
+		dirsFirst = v
+	}
+
+	maxPerDir := 0
+	if v, ok := args["max_per_dir"].(float64); ok && v > 0 {
+		maxPerDir = int(v)
+	}
+
+	format := "json"
+	if v, ok := args["format"].(string); ok && v != "" {
+		if v != "json" && v != "tree" {
+			return toolError(fmt.Sprintf("unknown format %q (valid: json, tree)", v)), nil
+		}
+		format = v
+	}
+
+	walk := &lsWalk{
+		maxDepth:      depth,
+		pattern:       pattern,
+		includeHidden: includeHidden,
+		limit:         limit,
+		sortBy:        sortBy,
+		reverse:       reverse,
+		dirsFirst:     dirsFirst,
+		maxPerDir:     maxPerDir,
+	}
+	var after []lsSortKey
+	if resume != nil {
+		after, _ = resume.Data.([]lsSortKey)
+	}
+
+	entries, err := listDir(absPath, 0, walk, nil, after)
 	if err != nil {
 		return toolError(fmt.Sprintf("failed to list directory: %s", err.Error())), nil
 	}
 
-	jsonBytes, err := json.MarshalIndent(entries, "", "  ")
+	nextCursor := ""
+	if walk.truncated {
+		nextCursor, err = tm.dependencies.Cursors.Put(state.Cursor{
+			Owner:    sessionIDFromCtx(ctx),
+			Tool:     "ls",
+			Args:     args,
+			Position: walk.lastPath,
+			Data:     walk.last,
+		})
+		if err != nil {
+			return toolError(err.Error()), nil
+		}
+	}
+
+	if format == "tree" {
+		return toolSuccess(formatLsTree(absPath, entries, nextCursor)), nil
+	}
+
+	var output interface{} = entries
+	if limit > 0 {
+		page := map[string]interface{}{
+			"entries":   entries,
+			"truncated": walk.truncated,
+		}
+		if walk.truncated {
+			page["next_cursor"] = nextCursor
+		}
+		output = page
+	}
+
+	jsonBytes, err := json.MarshalIndent(output, "", "  ")
 	if err != nil {
 		return toolError(fmt.Sprintf("failed to marshal results: %s", err.Error())), nil
 	}
@@ -71,8 +176,57 @@ func (tm *ToolsManager) HandleLs(ctx context.Context, request mcp.CallToolReques
 	return toolSuccess(string(jsonBytes)), nil
 }
 
-func listDir(dirPath string, maxDepth int, currentDepth int, pattern string, includeHidden bool) ([]lsEntry, error) {
-	if currentDepth >= maxDepth {
+var lsSortKeys = map[string]bool{
+	"name":  true,
+	"size":  true,
+	"mtime": true,
+	"type":  true,
+}
+
+// lsWalk carries the options and pagination state of a single ls call through listDir.
+// A limit of 0 lists everything. last holds the sort keys of the last entry emitted and
+// of its ancestors, which is where the next page resumes.
+type lsWalk struct {
+	maxDepth      int
+	pattern       string
+	includeHidden bool
+	limit         int
+	sortBy        string
+	reverse       bool
+	dirsFirst     bool
+	maxPerDir     int
+
+	resumed   bool
+	emitted   int
+	truncated bool
+	last      []lsSortKey
+	lastPath  string
+}
+
+// lsCandidate is a directory entry that passed the filters, waiting to be sorted.
+type lsCandidate struct {
+	entry os.DirEntry
+	info  os.FileInfo
+	key   lsSortKey
+}
+
+// lsSortKey is what the sort order of an entry depends on. Cursors keep the keys seen
+// when the page was produced, so a page resumes after the same entry even if it changed
+// or moved since.
+type lsSortKey struct {
+	Name    string
+	Dir     bool
+	Size    int64
+	ModTime time.Time
+}
+
+// listDir lists dirPath, trail holding the keys of the directories above it. When after is
+// set, dirPath lies on the path of the entry a previous page ended with, after[0] being
+// the key of its component in dirPath: entries ordered before it were fully returned and
+// are skipped, while the entry itself is repeated as a container when the page continues
+// inside it. With the default name order this is walkOrderCompare, as for search cursors.
+func listDir(dirPath string, currentDepth int, walk *lsWalk, trail, after []lsSortKey) ([]lsEntry, error) {
+	if currentDepth >= walk.maxDepth {
 		return nil, nil
 	}
 
@@ -81,48 +235,196 @@ func listDir(dirPath string, maxDepth int, currentDepth int, pattern string, inc
 		return nil, err
 	}
 
-	var entries []lsEntry
+	var candidates []lsCandidate
 	for _, de := range dirEntries {
 		name := de.Name()
 
-		if !includeHidden && strings.HasPrefix(name, ".") {
+		if !walk.includeHidden && strings.HasPrefix(name, ".") {
 			continue
 		}
 
-		if pattern != "" {
-			matched, _ := filepath.Match(pattern, name)
+		if walk.pattern != "" {
+			matched, _ := filepath.Match(walk.pattern, name)
 			if !matched && !de.IsDir() {
 				continue
 			}
 		}
 
-		fullPath := filepath.Join(dirPath, name)
 		info, err := de.Info()
 		if err != nil {
 			continue
 		}
 
+		candidates = append(candidates, lsCandidate{
+			entry: de,
+			info:  info,
+			key:   lsSortKey{Name: name, Dir: de.IsDir(), Size: info.Size(), ModTime: info.ModTime()},
+		})
+	}
+
+	sortLsCandidates(candidates, walk)
+
+	omitted := 0
+	if walk.maxPerDir > 0 && len(candidates) > walk.maxPerDir {
+		omitted = len(candidates) - walk.maxPerDir
+		candidates = candidates[:walk.maxPerDir]
+	}
+
+	var entries []lsEntry
+	for _, c := range candidates {
+		name := c.entry.Name()
+		fullPath := filepath.Join(dirPath, name)
+
+		// Entries from earlier pages are only walked through; a directory among them is
+		// kept as a continued container when some of its descendants land on this page
+		previous := false
+		var below []lsSortKey
+		if len(after) > 0 {
+			if c.key.Name == after[0].Name {
+				previous = true
+				below = after[1:]
+			} else if walk.less(c.key, after[0]) {
+				continue
+			}
+		}
+		if !previous {
+			walk.resumed = true
+		}
+
+		if !previous && walk.limit > 0 && walk.emitted >= walk.limit {
+			walk.truncated = true
+			break
+		}
+
 		entry := lsEntry{
-			Name:    name,
-			Path:    fullPath,
-			Type:    "file",
-			Size:    info.Size(),
-			Mode:    info.Mode().String(),
-			ModTime: info.ModTime().Format("2006-01-02 15:04:05"),
+			Name:      name,
+			Path:      fullPath,
+			Type:      "file",
+			Size:      c.info.Size(),
+			Mode:      c.info.Mode().String(),
+			ModTime:   c.info.ModTime().Format("2006-01-02 15:04:05"),
+			Continued: previous,
+		}
+		path := append(trail[:len(trail):len(trail)], c.key)
+		if !previous {
+			walk.emitted++
+			walk.last = path
+			walk.lastPath = fullPath
 		}
 
-		if de.IsDir() {
+		if c.entry.IsDir() {
 			entry.Type = "directory"
 			entry.Size = 0
 
-			children, err := listDir(fullPath, maxDepth, currentDepth+1, pattern, includeHidden)
+			children, err := listDir(fullPath, currentDepth+1, walk, path, below)
 			if err == nil && len(children) > 0 {
 				entry.Children = children
 			}
 		}
 
-		entries = append(entries, entry)
+		if !previous || len(entry.Children) > 0 {
+			entries = append(entries, entry)
+		}
+
+		if walk.truncated {
+			break
+		}
+	}
+
+	// The placeholder belongs to the page that completed the directory, which is
+	// a previous page when every kept entry had already been returned
+	if omitted > 0 && !walk.truncated && walk.resumed {
+		entries = append(entries, lsEntry{
+			Name:    fmt.Sprintf("%d more", omitted),
+			Path:    dirPath,
+			Type:    "more",
+			Omitted: omitted,
+		})
 	}
 
 	return entries, nil
 }
+
+// sortLsCandidates orders the entries of one directory as walk.less does.
+func sortLsCandidates(candidates []lsCandidate, walk *lsWalk) {
+	sort.Slice(candidates, func(i, j int) bool {
+		return walk.less(candidates[i].key, candidates[j].key)
+	})
+}
+
+// less orders two entries of the same directory. Names sort ascending while size and
+// mtime sort largest and newest first, like ls -S and ls -t; type groups directories
+// before files and then sorts by extension. Ties always fall back to the name.
+func (walk *lsWalk) less(a, b lsSortKey) bool {
+	if walk.dirsFirst && a.Dir != b.Dir {
+		return a.Dir
+	}
+	if walk.reverse {
+		a, b = b, a
+	}
+
+	switch walk.sortBy {
+	case "size":
+		if a.Size != b.Size {
+			return a.Size > b.Size
+		}
+	case "mtime":
+		if !a.ModTime.Equal(b.ModTime) {
+			return a.ModTime.After(b.ModTime)
+		}
+	case "type":
+		if a.Dir != b.Dir {
+			return a.Dir
+		}
+		if extA, extB := filepath.Ext(a.Name), filepath.Ext(b.Name); extA != extB {
+			return extA < extB
+		}
+	}
+	return a.Name < b.Name
+}
+
+// formatLsTree renders entries as an indented text tree in the style of the tree command.
+// Directories end with a slash and the totals count only entries of this page.
+func formatLsTree(root string, entries []lsEntry, nextCursor string) string {
+	var sb strings.Builder
+	sb.WriteString(root)
+	sb.WriteByte('\n')
+
+	dirs, files := 0, 0
+	var render func(entries []lsEntry, prefix string)
+	render = func(entries []lsEntry, prefix string) {
+		for i, entry := range entries {
+			branch, indent := "├── ", "│   "
+			if i == len(entries)-1 {
+				branch, indent = "└── ", "    "
+			}
+
+			name := entry.Name
+			switch {
+			case entry.Type == "more":
+				name = "… " + name
+			case entry.Type == "directory":
+				name += "/"
+				if !entry.Continued {
+					dirs++
+				}
+			case !entry.Continued:
+				files++
+			}
+			if entry.Continued {
+				name += " (continued)"
+			}
+
+			sb.WriteString(prefix + branch + name + "\n")
+			render(entry.Children, prefix+indent)
+		}
+	}
+	render(entries, "")
+
+	fmt.Fprintf(&sb, "\n%d directories, %d files", dirs, files)
+	if nextCursor != "" {
+		fmt.Fprintf(&sb, "\n[truncated] next_cursor: %s", nextCursor)
+	}
+
+	return sb.String()
+}
@@ -0,0 +1,185 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	//
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// mergeInput is one of the three versions given to merge, already split into lines.
+type mergeInput struct {
+	lines []string
+	label string
+}
+
+func (tm *ToolsManager) HandleMerge(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	args := request.GetArguments()
+	payload := jwtPayloadFromCtx(ctx)
+
+	format := "markers"
+	if v, ok := args["format"].(string); ok && v != "" {
+		if v != "markers" && v != "json" {
+			return toolError(fmt.Sprintf("unknown format %q (valid: markers, json)", v)), nil
+		}
+		format = v
+	}
+
+	write := false
+	if v, ok := args["write"].(bool); ok {
+		write = v
+	}
+
+	diff3 := false
+	if v, ok := args["diff3"].(bool); ok {
+		diff3 = v
+	}
+
+	// The write-back target is resolved first so that a denied write fails before any reading
+	target := ""
+	if path, ok := args["path"].(string); ok && path != "" {
+		if err := sanitizePath(path); err != nil {
+			return toolError(err.Error()), nil
+		}
+		absPath, err := filepath.Abs(path)
+		if err != nil {
+			return toolError(fmt.Sprintf("invalid path: %s", err.Error())), nil
+		}
+		target = absPath
+	}
+	if write {
+		if target == "" {
+			return toolError("path parameter is required when write is true"), nil
+		}
+		if err := tm.dependencies.RBAC.Check("merge", []string{target}, payload); err != nil {
+			return toolError(err.Error()), nil
+		}
+	}
+
+	inputs := make(map[string]*mergeInput, 3)
+	for _, side := range []string{"base", "ours", "theirs"} {
+		input, err := tm.mergeInput(ctx, args, side)
+		if err != nil {
+			return toolError(err.Error()), nil
+		}
+		inputs[side] = input
+	}
+
+	merged, conflicts := merge3(inputs["base"].lines, inputs["ours"].lines, inputs["theirs"].lines, mergeMarkers{
+		ours:   "ours: " + inputs["ours"].label,
+		base:   "base: " + inputs["base"].label,
+		theirs: "theirs: " + inputs["theirs"].label,
+		diff3:  diff3,
+	})
+
+	content := ""
+	if len(merged) > 0 {
+		content = strings.Join(merged, "\n") + "\n"
+	}
+
+	if write {
+		mode := os.FileMode(0644)
+		if info, err := os.Stat(target); err == nil {
+			mode = info.Mode().Perm()
+		}
+
+		if err := tm.dependencies.Undo.Save(target, undoOriginFromCtx(ctx, "merge")); err != nil {
+			tm.dependencies.AppCtx.Logger.Error("failed to save undo state", "path", target, "error", err.Error())
+		}
+
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return toolError(fmt.Sprintf("failed to create parent directories: %s", err.Error())), nil
+		}
+
+		if err := os.WriteFile(target, []byte(content), mode); err != nil {
+			return toolError(fmt.Sprintf("failed to write file: %s", err.Error())), nil
+		}
+	}
+
+	if format == "json" {
+		result := map[string]interface{}{
+			"clean":     len(conflicts) == 0,
+			"conflicts": conflicts,
+		}
+		if write {
+			result["written"] = target
+		} else {
+			result["merged"] = content
+		}
+
+		jsonBytes, err := json.MarshalIndent(result, "", "  ")
+		if err != nil {
+			return toolError(fmt.Sprintf("failed to marshal results: %s", err.Error())), nil
+		}
+		return toolSuccess(string(jsonBytes)), nil
+	}
+
+	if write {
+		if len(conflicts) > 0 {
+			return toolSuccess(fmt.Sprintf("Merged into %s with %d conflicts marked", target, len(conflicts))), nil
+		}
+		return toolSuccess(fmt.Sprintf("Merged cleanly into %s", target)), nil
+	}
+
+	return toolSuccess(content), nil
+}
+
+// mergeInput reads one side of a merge from exactly one of <side>_path, <side>_content
+// or <side>_undo, the latter being the undo snapshot of the given path. Paths are checked
+// against the merge operation, like the write-back target.
+func (tm *ToolsManager) mergeInput(ctx context.Context, args map[string]interface{}, side string) (*mergeInput, error) {
+	path, _ := args[side+"_path"].(string)
+	content, hasContent := args[side+"_content"].(string)
+	undoPath, _ := args[side+"_undo"].(string)
+
+	sources := 0
+	for _, given := range []bool{path != "", hasContent, undoPath != ""} {
+		if given {
+			sources++
+		}
+	}
+	if sources != 1 {
+		return nil, fmt.Errorf("exactly one of %s_path, %s_content or %s_undo is required", side, side, side)
+	}
+
+	if hasContent {
+		return &mergeInput{lines: splitLines(content), label: "inline"}, nil
+	}
+
+	if path == "" {
+		path = undoPath
+	}
+	if err := sanitizePath(path); err != nil {
+		return nil, err
+	}
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s path: %s", side, err.Error())
+	}
+	if err := tm.dependencies.RBAC.Check("merge", []string{absPath}, jwtPayloadFromCtx(ctx)); err != nil {
+		return nil, err
+	}
+
+	if undoPath != "" {
+		snapshot, existed, err := tm.dependencies.Undo.Snapshot(absPath, undoOriginFromCtx(ctx, "merge"), tm.undoOverride(ctx, []string{absPath}))
+		if err != nil {
+			return nil, err
+		}
+		input := &mergeInput{label: absPath + " (undo snapshot)"}
+		if existed {
+			input.lines = splitLines(string(snapshot))
+		}
+		return input, nil
+	}
+
+	data, err := os.ReadFile(absPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %s", absPath, err.Error())
+	}
+	return &mergeInput{lines: splitLines(string(data)), label: absPath}, nil
+}
@@ -63,6 +63,13 @@ func (tm *ToolsManager) HandleReadFile(ctx context.Context, request mcp.CallTool
 	}
 	totalLines := len(allLines)
 
+	if symbol, ok := args["symbol"].(string); ok && symbol != "" {
+		if rawRanges, ok := args["ranges"]; ok && rawRanges != nil {
+			return toolError("use either ranges or symbol, not both"), nil
+		}
+		return readSymbol(absPath, symbol, allLines)
+	}
+
 	var ranges []readRange
 	if rawRanges, ok := args["ranges"]; ok && rawRanges != nil {
 		rangesJSON, err := json.Marshal(rawRanges)
@@ -122,3 +129,45 @@ func (tm *ToolsManager) HandleReadFile(ctx context.Context, request mcp.CallTool
 
 	return toolSuccess(string(jsonBytes)), nil
 }
+
+// readSymbol returns the Go declaration named symbol, including its doc comment, numbered
+// like a full read. symbol is either a plain name or Receiver.Method. When several
+// declarations share the name, the candidates are listed instead.
+func readSymbol(path string, symbol string, allLines []string) (*mcp.CallToolResult, error) {
+	if !strings.HasSuffix(path, ".go") {
+		return toolError("symbol is only supported for Go files"), nil
+	}
+
+	symbols, err := parseGoSymbols(path, []byte(strings.Join(allLines, "\n")))
+	if err != nil {
+		return toolError(fmt.Sprintf("failed to parse Go file: %s", err.Error())), nil
+	}
+
+	var found []goSymbol
+	for _, s := range symbols {
+		if s.QualifiedName() == symbol || (!strings.Contains(symbol, ".") && s.Name == symbol) {
+			found = append(found, s)
+		}
+	}
+
+	switch len(found) {
+	case 0:
+		return toolError(fmt.Sprintf("symbol %q not found in %s", symbol, path)), nil
+
+	case 1:
+		s := found[0]
+		var sb strings.Builder
+		for i := s.docLine; i <= s.EndLine && i < len(allLines); i++ {
+			fmt.Fprintf(&sb, "%d: %s\n", i, allLines[i])
+		}
+		return toolSuccess(fmt.Sprintf("(%s %s, lines %d-%d of %d)\n%s", s.Kind, s.QualifiedName(), s.docLine, s.EndLine, len(allLines), sb.String())), nil
+
+	default:
+		var sb strings.Builder
+		fmt.Fprintf(&sb, "symbol %q is ambiguous in %s; use one of:\n", symbol, path)
+		for _, s := range found {
+			fmt.Fprintf(&sb, "- %s (%s, lines %d-%d)\n", s.QualifiedName(), s.Kind, s.StartLine, s.EndLine)
+		}
+		return toolError(sb.String()), nil
+	}
+}
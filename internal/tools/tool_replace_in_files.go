@@ -0,0 +1,286 @@
+package tools
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"strings"
+
+	//
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+type replaceFileChange struct {
+	Path         string `json:"path"`
+	Replacements int    `json:"replacements"`
+	Diff         string `json:"diff,omitempty"`
+}
+
+type replaceFileIssue struct {
+	Path  string `json:"path"`
+	Error string `json:"error"`
+}
+
+// plannedReplace is a single file rewrite computed by planReplace but not yet written.
+type plannedReplace struct {
+	path         string
+	hash         string
+	mode         os.FileMode
+	oldContent   string
+	newContent   string
+	replacements int
+}
+
+func (tm *ToolsManager) HandleReplaceInFiles(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	args := request.GetArguments()
+
+	// A preview token replays the exact arguments that produced the preview
+	var previewed map[string]string
+	previewToken, _ := args["preview_token"].(string)
+	if previewToken != "" {
+		preview, err := tm.dependencies.Previews.Take(previewToken, sessionIDFromCtx(ctx))
+		if err != nil {
+			return toolError(err.Error()), nil
+		}
+		args = preview.Args
+		previewed = preview.Hashes
+	}
+
+	searchPath, ok := args["path"].(string)
+	if !ok || searchPath == "" {
+		return toolError("path parameter is required"), nil
+	}
+
+	if err := sanitizePath(searchPath); err != nil {
+		return toolError(err.Error()), nil
+	}
+
+	absPath, err := filepath.Abs(searchPath)
+	if err != nil {
+		return toolError(fmt.Sprintf("invalid path: %s", err.Error())), nil
+	}
+
+	if err := tm.dependencies.RBAC.Check("search", []string{absPath}, jwtPayloadFromCtx(ctx)); err != nil {
+		return toolError(err.Error()), nil
+	}
+
+	replacement, ok := args["replacement"].(string)
+	if !ok {
+		return toolError("replacement parameter is required"), nil
+	}
+
+	literal := false
+	if v, ok := args["literal"].(bool); ok {
+		literal = v
+	}
+
+	apply := previewToken != ""
+	if v, ok := args["apply"].(bool); ok && v {
+		apply = true
+	}
+
+	// Replacements always run on the whole content, with ^ and $ anchored at line boundaries
+	searchArgs := maps.Clone(args)
+	searchArgs["multiline"] = true
+	opts, err := parseSearchOptions(searchArgs)
+	if err != nil {
+		return toolError(err.Error()), nil
+	}
+	tm.useIndex(&opts)
+
+	var planned []plannedReplace
+	var denied []replaceFileIssue
+	var skipped searchSkipped
+	err = walkSearchable(ctx, absPath, opts, func(filePath string) error {
+		change, err := planReplace(filePath, opts, replacement, literal)
+		if err != nil {
+			skipped.add(filePath, err)
+			return nil
+		}
+		if change == nil {
+			return nil
+		}
+
+		if err := tm.dependencies.RBAC.Check("replace_in_files", []string{filePath}, jwtPayloadFromCtx(ctx)); err != nil {
+			denied = append(denied, replaceFileIssue{Path: filePath, Error: err.Error()})
+			return nil
+		}
+
+		planned = append(planned, *change)
+		return nil
+	})
+	if err != nil {
+		return toolError(fmt.Sprintf("replace error: %s", err.Error())), nil
+	}
+
+	if !apply {
+		return tm.replacePreview(ctx, request.GetArguments(), planned, denied, skipped)
+	}
+
+	var applied []replaceFileChange
+	var conflicts, failed []replaceFileIssue
+
+	for _, change := range planned {
+		if previewed != nil && previewed[change.path] != change.hash {
+			conflicts = append(conflicts, replaceFileIssue{Path: change.path, Error: "file changed since the preview was generated"})
+			continue
+		}
+
+		if err := tm.dependencies.Undo.Save(change.path, undoOriginFromCtx(ctx, "replace_in_files")); err != nil {
+			tm.dependencies.AppCtx.Logger.Error("failed to save undo state", "path", change.path, "error", err.Error())
+		}
+
+		if err := os.WriteFile(change.path, []byte(change.newContent), change.mode); err != nil {
+			failed = append(failed, replaceFileIssue{Path: change.path, Error: err.Error()})
+			continue
+		}
+
+		applied = append(applied, replaceFileChange{Path: change.path, Replacements: change.replacements})
+	}
+
+	// Files present in the preview that no longer match were changed on disk in the meantime
+	for path := range previewed {
+		found := false
+		for _, change := range planned {
+			if change.path == path {
+				found = true
+				break
+			}
+		}
+		if !found {
+			conflicts = append(conflicts, replaceFileIssue{Path: path, Error: "file no longer matches the previewed change"})
+		}
+	}
+
+	result := map[string]interface{}{
+		"applied":   true,
+		"files":     applied,
+		"denied":    denied,
+		"conflicts": conflicts,
+		"failed":    failed,
+	}
+	if !skipped.empty() {
+		result["skipped"] = skipped
+	}
+
+	jsonBytes, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return toolError(fmt.Sprintf("failed to marshal results: %s", err.Error())), nil
+	}
+
+	if len(applied) == 0 && len(planned)+len(conflicts) > 0 {
+		return toolError(string(jsonBytes)), nil
+	}
+
+	return toolSuccess(string(jsonBytes)), nil
+}
+
+// replacePreview renders the per-file diffs of planned and stores a token that applies them later.
+func (tm *ToolsManager) replacePreview(ctx context.Context, args map[string]interface{}, planned []plannedReplace, denied []replaceFileIssue, skipped searchSkipped) (*mcp.CallToolResult, error) {
+	hashes := make(map[string]string, len(planned))
+	files := make([]replaceFileChange, 0, len(planned))
+	total := 0
+
+	for _, change := range planned {
+		hashes[change.path] = change.hash
+		total += change.replacements
+		files = append(files, replaceFileChange{
+			Path:         change.path,
+			Replacements: change.replacements,
+			Diff:         computeDiff(change.path, change.path, splitLines(change.oldContent), splitLines(change.newContent), 0, 0, diffDefaultContext),
+		})
+	}
+
+	storedArgs := maps.Clone(args)
+	delete(storedArgs, "apply")
+	delete(storedArgs, "preview_token")
+
+	result := map[string]interface{}{
+		"applied":            false,
+		"files":              files,
+		"denied":             denied,
+		"total_files":        len(files),
+		"total_replacements": total,
+	}
+	if !skipped.empty() {
+		result["skipped"] = skipped
+	}
+
+	if len(planned) > 0 {
+		token, err := tm.dependencies.Previews.Put(sessionIDFromCtx(ctx), storedArgs, hashes)
+		if err != nil {
+			return toolError(err.Error()), nil
+		}
+		result["preview_token"] = token
+	}
+
+	jsonBytes, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return toolError(fmt.Sprintf("failed to marshal results: %s", err.Error())), nil
+	}
+
+	return toolSuccess(string(jsonBytes)), nil
+}
+
+// planReplace computes the new content of filePath. Returns nil when the pattern does not
+// match, and the error of openSearchable when the file is skipped (binary, oversized).
+func planReplace(filePath string, opts searchOptions, replacement string, literal bool) (*plannedReplace, error) {
+	file, reader, err := openSearchable(filePath, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	var sb strings.Builder
+	if _, err := reader.WriteTo(&sb); err != nil {
+		return nil, err
+	}
+	content := sb.String()
+
+	count := len(opts.re.FindAllStringIndex(content, -1))
+	if count == 0 {
+		return nil, nil
+	}
+
+	var newContent string
+	if literal {
+		newContent = opts.re.ReplaceAllLiteralString(content, replacement)
+	} else {
+		newContent = opts.re.ReplaceAllString(content, replacement)
+	}
+	if newContent == content {
+		return nil, nil
+	}
+
+	sum := sha256.Sum256([]byte(content))
+	return &plannedReplace{
+		path:         filePath,
+		hash:         hex.EncodeToString(sum[:]),
+		mode:         info.Mode().Perm(),
+		oldContent:   content,
+		newContent:   newContent,
+		replacements: count,
+	}, nil
+}
+
+// splitLines splits content into lines the same way readLines does for files on disk.
+func splitLines(content string) []string {
+	if content == "" {
+		return nil
+	}
+	lines := strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSuffix(line, "\r")
+	}
+	return lines
+}
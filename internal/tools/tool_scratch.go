@@ -4,11 +4,16 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"math"
+	"time"
 
 	//
 	"github.com/mark3labs/mcp-go/mcp"
 )
 
+// scratchMaxTTLSeconds bounds ttl_seconds to 30 days, past which a key might as well never expire
+const scratchMaxTTLSeconds = 30 * 24 * 60 * 60
+
 func (tm *ToolsManager) HandleScratch(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 	args := request.GetArguments()
 
@@ -27,7 +32,19 @@ func (tm *ToolsManager) HandleScratch(ctx context.Context, request mcp.CallToolR
 		if !ok {
 			return toolError("value parameter is required for set"), nil
 		}
-		tm.dependencies.Scratch.Set(key, value)
+		ttl := time.Duration(0)
+		if v, ok := args["ttl_seconds"].(float64); ok {
+			if math.IsNaN(v) || v <= 0 || v > scratchMaxTTLSeconds {
+				return toolError(fmt.Sprintf("ttl_seconds must be greater than 0 and at most %d", scratchMaxTTLSeconds)), nil
+			}
+			ttl = time.Duration(v * float64(time.Second))
+		}
+		if err := tm.dependencies.Scratch.Set(key, value, ttl); err != nil {
+			return toolError(err.Error()), nil
+		}
+		if ttl > 0 {
+			return toolSuccess(fmt.Sprintf("Stored key %q, expiring in %s", key, ttl)), nil
+		}
 		return toolSuccess(fmt.Sprintf("Stored key %q", key)), nil
 
 	case "get":
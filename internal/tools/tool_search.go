@@ -2,13 +2,25 @@ package tools
 
 import (
 	"bufio"
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
+	"math"
 	"os"
 	"path/filepath"
 	"regexp"
+	"runtime"
+	"sort"
 	"strings"
+	"sync"
+
+	//
+	"mcp-forge/internal/index"
+	"mcp-forge/internal/state"
 
 	//
 	"github.com/mark3labs/mcp-go/mcp"
@@ -17,6 +29,7 @@ import (
 type searchMatch struct {
 	File          string   `json:"file"`
 	Line          int      `json:"line"`
+	EndLine       *int     `json:"end_line,omitempty"`
 	Content       string   `json:"content"`
 	ContextBefore []string `json:"context_before,omitempty"`
 	ContextAfter  []string `json:"context_after,omitempty"`
@@ -25,9 +38,15 @@ type searchMatch struct {
 func (tm *ToolsManager) HandleSearch(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 	args := request.GetArguments()
 
-	pattern, ok := args["pattern"].(string)
-	if !ok || pattern == "" {
-		return toolError("pattern parameter is required"), nil
+	// A cursor replays the original arguments and resumes after the last returned match
+	var resume *state.Cursor
+	if token, _ := args["cursor"].(string); token != "" {
+		cursor, err := tm.dependencies.Cursors.Get(token, sessionIDFromCtx(ctx), "search")
+		if err != nil {
+			return toolError(err.Error()), nil
+		}
+		args = cursor.Args
+		resume = cursor
 	}
 
 	searchPath, ok := args["path"].(string)
@@ -48,14 +67,159 @@ func (tm *ToolsManager) HandleSearch(ctx context.Context, request mcp.CallToolRe
 		return toolError(err.Error()), nil
 	}
 
-	include := ""
+	opts, err := parseSearchOptions(args)
+	if err != nil {
+		return toolError(err.Error()), nil
+	}
+	tm.useIndex(&opts)
+
+	if resume != nil {
+		opts.resumeFile = resume.Position
+		opts.resumeSkip = resume.Skip
+	}
+
+	mode := searchOutputContent
+	if v, ok := args["output_mode"].(string); ok && v != "" {
+		mode = v
+	}
+
+	// File-oriented modes page by files instead of matches and have no use for context lines
+	switch mode {
+	case searchOutputContent, searchOutputGrouped:
+	case searchOutputFiles:
+		opts.limitFiles = true
+		opts.maxPerFile = 1
+		opts.contextLines = 0
+	case searchOutputCount:
+		opts.limitFiles = true
+		opts.contextLines = 0
+	default:
+		return toolError(fmt.Sprintf("unknown output_mode %q (valid: content, files_with_matches, count, grouped)", mode)), nil
+	}
+
+	// One extra match (or file) is collected to tell a full page from a truncated one
+	pageSize := opts.maxResults
+	opts.maxResults = pageSize + 1
+
+	matches, skipped, err := searchTree(ctx, absPath, opts)
+	if err != nil {
+		return toolError(fmt.Sprintf("search error: %s", err.Error())), nil
+	}
+
+	groups := groupSearchMatches(matches)
+
+	truncated := false
+	next := state.Cursor{
+		Owner: sessionIDFromCtx(ctx),
+		Tool:  "search",
+		Args:  args,
+	}
+
+	if opts.limitFiles {
+		// The next page starts right after the last file listed
+		truncated = len(groups) > pageSize
+		if truncated {
+			groups = groups[:pageSize]
+			next.Position = groups[len(groups)-1].File
+		}
+	} else {
+		truncated = len(matches) > pageSize
+		if truncated {
+			matches = matches[:pageSize]
+			groups = groupSearchMatches(matches)
+
+			last := matches[len(matches)-1].File
+			skip := 0
+			if last == opts.resumeFile {
+				skip = opts.resumeSkip
+			}
+			skip += len(groups[len(groups)-1].Matches)
+			next.Position = last
+			next.Skip = skip
+		}
+	}
+
+	nextCursor := ""
+	if truncated {
+		nextCursor, err = tm.dependencies.Cursors.Put(next)
+		if err != nil {
+			return toolError(err.Error()), nil
+		}
+	}
+
+	if mode != searchOutputContent {
+		return toolSuccess(formatSearchText(mode, groups, nextCursor, skipped)), nil
+	}
+
+	result := map[string]interface{}{
+		"matches":       matches,
+		"total_matches": len(matches),
+		"truncated":     truncated,
+	}
+	if truncated {
+		result["next_cursor"] = nextCursor
+	}
+	if !skipped.empty() {
+		result["skipped"] = skipped
+	}
+
+	jsonBytes, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return toolError(fmt.Sprintf("failed to marshal results: %s", err.Error())), nil
+	}
+
+	return toolSuccess(string(jsonBytes)), nil
+}
+
+// searchOptions holds the parameters shared by every file scanned in a single search.
+type searchOptions struct {
+	re            *regexp.Regexp
+	include       string
+	exclude       string
+	contextLines  int
+	maxResults    int
+	includeBinary bool
+	maxFileSize   int64
+	multiline     bool
+	gitignore     bool
+
+	// skipFile, when set, lets the walker leave out files known not to match without reading them
+	skipFile func(filePath string, d fs.DirEntry) bool
+
+	// resumeFile and resumeSkip continue a previous page: files before resumeFile in walk order
+	// are skipped, and so are the first resumeSkip matches of resumeFile itself
+	resumeFile string
+	resumeSkip int
+
+	// limitFiles makes maxResults count files with matches rather than matches, and
+	// resumeFile is then skipped entirely since it was fully reported. maxPerFile, when
+	// positive, stops scanning a file after that many matches
+	limitFiles bool
+	maxPerFile int
+
+	// workers is how many files are scanned in parallel, GOMAXPROCS when zero
+	workers int
+}
+
+// parseSearchOptions reads the search arguments shared by search and replace_in_files
+// and compiles the pattern accordingly.
+func parseSearchOptions(args map[string]interface{}) (searchOptions, error) {
+	opts := searchOptions{
+		maxResults:  100,
+		maxFileSize: searchDefaultMaxFileSize,
+	}
+
+	pattern, ok := args["pattern"].(string)
+	if !ok || pattern == "" {
+		return opts, errors.New("pattern parameter is required")
+	}
+
 	if v, ok := args["include"].(string); ok {
-		include = v
+		opts.include = v
 	}
 
-	exclude := ""
 	if v, ok := args["exclude"].(string); ok {
-		exclude = v
+		opts.exclude = v
 	}
 
 	literal := false
@@ -63,130 +227,510 @@ func (tm *ToolsManager) HandleSearch(ctx context.Context, request mcp.CallToolRe
 		literal = v
 	}
 
-	contextLines := 0
 	if v, ok := args["context_lines"].(float64); ok {
-		contextLines = int(v)
+		opts.contextLines = int(v)
 	}
 
-	maxResults := 100
 	if v, ok := args["max_results"].(float64); ok && v > 0 {
-		maxResults = int(v)
+		opts.maxResults = int(v)
+	}
+
+	if v, ok := args["include_binary"].(bool); ok {
+		opts.includeBinary = v
+	}
+
+	if v, ok := args["multiline"].(bool); ok {
+		opts.multiline = v
+	}
+
+	if v, ok := args["max_file_size"].(float64); ok && v > 0 {
+		opts.maxFileSize = int64(v)
+	}
+
+	if v, ok := args["gitignore"].(bool); ok {
+		opts.gitignore = v
 	}
 
 	if literal {
 		pattern = regexp.QuoteMeta(pattern)
 	}
 
+	// In multiline mode ^ and $ keep matching at line boundaries inside the whole-file content
+	if opts.multiline {
+		pattern = "(?m)" + pattern
+	}
+
 	re, err := regexp.Compile(pattern)
 	if err != nil {
-		return toolError(fmt.Sprintf("invalid regex pattern: %s", err.Error())), nil
+		return opts, fmt.Errorf("invalid regex pattern: %s", err.Error())
 	}
+	opts.re = re
 
-	var matches []searchMatch
+	return opts, nil
+}
 
-	err = filepath.Walk(absPath, func(filePath string, info os.FileInfo, err error) error {
-		if err != nil {
+// searchJob is a file queued by the walker. index is its position in walk order,
+// used to reassemble results deterministically regardless of which worker finishes first.
+type searchJob struct {
+	index int
+	path  string
+}
+
+type searchJobResult struct {
+	index   int
+	path    string
+	matches []searchMatch
+	skipped error
+}
+
+// errSearchOversize and errSearchBinary tell why a file was left out of a search.
+var (
+	errSearchOversize = errors.New("file exceeds max_file_size")
+	errSearchBinary   = errors.New("file looks binary")
+)
+
+// searchSkipped counts the files left out of a search because they are too large, look
+// binary or could not be read to the end, so that callers know the results may be
+// incomplete. Matches found in a file before a read error are still reported. Files
+// lists the first few with the reason.
+type searchSkipped struct {
+	Oversize   int                 `json:"oversize"`
+	Binary     int                 `json:"binary"`
+	Unreadable int                 `json:"unreadable"`
+	Files      []searchSkippedFile `json:"files,omitempty"`
+}
+
+type searchSkippedFile struct {
+	Path   string `json:"path"`
+	Reason string `json:"reason"`
+}
+
+// searchSkippedListMax is how many skipped files are listed by name.
+const searchSkippedListMax = 20
+
+func (s *searchSkipped) add(filePath string, reason error) {
+	switch {
+	case errors.Is(reason, context.Canceled), errors.Is(reason, context.DeadlineExceeded):
+		// Cut short along with the whole search, which reports it
+		return
+	case errors.Is(reason, errSearchOversize):
+		s.Oversize++
+	case errors.Is(reason, errSearchBinary):
+		s.Binary++
+	default:
+		s.Unreadable++
+	}
+	if len(s.Files) < searchSkippedListMax {
+		s.Files = append(s.Files, searchSkippedFile{Path: filePath, Reason: reason.Error()})
+	}
+}
+
+func (s *searchSkipped) empty() bool {
+	return s.Oversize == 0 && s.Binary == 0 && s.Unreadable == 0
+}
+
+// String summarizes the skipped files on one line for the text output modes.
+func (s *searchSkipped) String() string {
+	return fmt.Sprintf("[skipped] %d oversize, %d binary and %d unreadable files, see max_file_size and include_binary", s.Oversize, s.Binary, s.Unreadable)
+}
+
+const (
+	// searchCtxCheckInterval is how many lines are scanned between cancellation checks.
+	searchCtxCheckInterval = 1024
+
+	// searchDefaultMaxFileSize is the size above which files are skipped unless max_file_size says otherwise.
+	searchDefaultMaxFileSize = 10 * 1024 * 1024
+
+	// binarySniffSize is how much of a file is inspected to decide whether it is binary.
+	binarySniffSize = 8000
+
+	// searchWindowPerWorker is how many files per worker the walker may queue ahead of the
+	// oldest file whose results are still awaited. It bounds the results buffered for reordering.
+	searchWindowPerWorker = 4
+)
+
+// searchTree walks root and scans the files it finds with a bounded pool of workers.
+// Matches are returned in walk order, exactly as a sequential scan would produce them,
+// along with the files skipped up to the last one scanned. The walk stops as soon as
+// maxResults matches are collected or ctx is cancelled.
+func searchTree(parent context.Context, root string, opts searchOptions) ([]searchMatch, searchSkipped, error) {
+	ctx, cancel := context.WithCancel(parent)
+	defer cancel()
+
+	jobs := make(chan searchJob)
+	results := make(chan searchJobResult)
+
+	workers := opts.workers
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+
+	// A slot is taken for every file queued and given back once its results are emitted in
+	// order, so one slow file cannot let the results of all the others pile up behind it
+	window := make(chan struct{}, workers*searchWindowPerWorker)
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				fileOpts := opts
+				skip := 0
+				switch {
+				case opts.limitFiles && opts.maxPerFile > 0:
+					fileOpts.maxResults = opts.maxPerFile
+				case opts.limitFiles:
+					fileOpts.maxResults = math.MaxInt
+				case job.path == opts.resumeFile:
+					skip = opts.resumeSkip
+					fileOpts.maxResults += skip
+				}
+
+				var fileMatches []searchMatch
+				var err error
+				if opts.multiline {
+					fileMatches, err = searchInFileMultiline(ctx, job.path, fileOpts)
+				} else {
+					fileMatches, err = searchInFile(ctx, job.path, fileOpts)
+				}
+				if skip > 0 {
+					fileMatches = fileMatches[min(skip, len(fileMatches)):]
+				}
+				select {
+				case results <- searchJobResult{index: job.index, path: job.path, matches: fileMatches, skipped: err}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+
+	walkErr := make(chan error, 1)
+	go func() {
+		defer close(jobs)
+		index := 0
+		walkErr <- walkSearchable(ctx, root, opts, func(filePath string) error {
+			select {
+			case window <- struct{}{}:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+			select {
+			case jobs <- searchJob{index: index, path: filePath}:
+				index++
+			case <-ctx.Done():
+				return ctx.Err()
+			}
 			return nil
+		})
+	}()
+
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	// Results arrive out of order; buffer them until the next expected index shows up
+	var matches []searchMatch
+	var skipped searchSkipped
+	pending := make(map[int]searchJobResult)
+	next := 0
+	files := 0
+	for res := range results {
+		pending[res.index] = res
+		for {
+			res, ok := pending[next]
+			if !ok {
+				break
+			}
+			delete(pending, next)
+			next++
+			<-window
+
+			// Files handled after the last page was full were not needed anyway
+			full := len(matches) >= opts.maxResults
+			if opts.limitFiles {
+				full = files >= opts.maxResults
+			}
+			if res.skipped != nil && !full {
+				skipped.add(res.path, res.skipped)
+			}
+
+			fileMatches := res.matches
+			if opts.limitFiles {
+				if files >= opts.maxResults || len(fileMatches) == 0 {
+					continue
+				}
+				matches = append(matches, fileMatches...)
+				files++
+				if files >= opts.maxResults {
+					cancel()
+				}
+				continue
+			}
+
+			if len(matches) >= opts.maxResults {
+				continue
+			}
+			remaining := opts.maxResults - len(matches)
+			if len(fileMatches) > remaining {
+				fileMatches = fileMatches[:remaining]
+			}
+			matches = append(matches, fileMatches...)
+			if len(matches) >= opts.maxResults {
+				cancel()
+			}
 		}
+	}
+
+	err := <-walkErr
+
+	// A cancellation triggered by hitting maxResults is not an error; one coming from the caller is
+	if parentErr := parent.Err(); parentErr != nil {
+		return nil, skipped, fmt.Errorf("search cancelled: %s", parentErr.Error())
+	}
+	if err != nil && !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded) {
+		return nil, skipped, err
+	}
+
+	return matches, skipped, nil
+}
 
-		if info.IsDir() {
+// walkSearchable walks root in lexical order and calls visit for every regular file that
+// passes the include/exclude globs and, when enabled, the ignore files.
+func walkSearchable(ctx context.Context, root string, opts searchOptions, visit func(filePath string) error) error {
+	var ignore *ignoreMatcher
+	if opts.gitignore {
+		ignore = newIgnoreMatcher(root)
+	}
+
+	return filepath.WalkDir(root, func(filePath string, d fs.DirEntry, err error) error {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+
+		if err != nil {
 			return nil
 		}
 
-		if include != "" {
-			matched, _ := filepath.Match(include, info.Name())
-			if !matched {
-				return nil
+		if ignore != nil && filePath != root && ignore.Ignored(filePath, d.IsDir()) {
+			if d.IsDir() {
+				return filepath.SkipDir
 			}
+			return nil
 		}
 
-		if exclude != "" {
-			matched, _ := filepath.Match(exclude, info.Name())
-			if matched {
+		// When resuming, everything visited before resumeFile was covered by earlier pages
+		if opts.resumeFile != "" {
+			order := walkOrderCompare(filePath, opts.resumeFile)
+			if order < 0 || (order == 0 && opts.limitFiles && !d.IsDir()) {
+				if d.IsDir() && !isPathWithin(opts.resumeFile, filePath) {
+					return filepath.SkipDir
+				}
 				return nil
 			}
 		}
 
-		if len(matches) >= maxResults {
-			return filepath.SkipAll
+		if d.IsDir() || !searchFileSelected(d.Name(), opts) {
+			return nil
 		}
 
-		fileMatches, err := searchInFile(filePath, re, contextLines, maxResults-len(matches))
-		if err != nil {
+		if opts.skipFile != nil && opts.skipFile(filePath, d) {
 			return nil
 		}
 
-		matches = append(matches, fileMatches...)
-		return nil
+		return visit(filePath)
 	})
+}
 
-	if err != nil {
-		return toolError(fmt.Sprintf("search error: %s", err.Error())), nil
+// useIndex narrows the files scanned for opts to those the trigram index cannot rule out.
+// It is a no-op when indexing is disabled.
+func (tm *ToolsManager) useIndex(opts *searchOptions) {
+	if tm.dependencies.Index == nil || !tm.dependencies.Index.Enabled() {
+		return
 	}
 
-	result := map[string]interface{}{
-		"matches":       matches,
-		"total_matches": len(matches),
-		"truncated":     len(matches) >= maxResults,
+	query := index.NewQuery(opts.re)
+	if query.MatchesAll() {
+		return
 	}
 
-	jsonBytes, err := json.MarshalIndent(result, "", "  ")
+	opts.skipFile = func(filePath string, d fs.DirEntry) bool {
+		info, err := d.Info()
+		if err != nil {
+			return false
+		}
+		return tm.dependencies.Index.Skip(filePath, info, query)
+	}
+}
+
+func searchFileSelected(name string, opts searchOptions) bool {
+	if opts.include != "" {
+		matched, _ := filepath.Match(opts.include, name)
+		if !matched {
+			return false
+		}
+	}
+
+	if opts.exclude != "" {
+		matched, _ := filepath.Match(opts.exclude, name)
+		if matched {
+			return false
+		}
+	}
+
+	return true
+}
+
+// searchInFile streams filePath line by line, keeping only the last contextLines lines in memory.
+// Binary files and files larger than opts.maxFileSize are skipped with the error of openSearchable.
+// A read error stops the scan: the matches found before it are returned along with it.
+func searchInFile(ctx context.Context, filePath string, opts searchOptions) ([]searchMatch, error) {
+	file, reader, err := openSearchable(filePath, opts)
 	if err != nil {
-		return toolError(fmt.Sprintf("failed to marshal results: %s", err.Error())), nil
+		return nil, err
 	}
+	defer file.Close()
 
-	return toolSuccess(string(jsonBytes)), nil
+	// No line is longer than the file, so any file within max_file_size scans to the end
+	maxLine := opts.maxFileSize
+	if maxLine <= 0 {
+		maxLine = searchDefaultMaxFileSize
+	}
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 0, min(64*1024, maxLine+1)), int(maxLine)+1)
+
+	var matches []searchMatch
+	before := newLineRing(opts.contextLines)
+
+	// pending holds indexes into matches that are still collecting their trailing context
+	var pending []int
+
+	lineNum := 0
+	for ; scanner.Scan(); lineNum++ {
+		if lineNum%searchCtxCheckInterval == 0 {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+		}
+
+		line := strings.TrimRight(scanner.Text(), "\r\n")
+
+		// Context lines are only formatted when they can actually be emitted
+		numbered := ""
+		if opts.contextLines > 0 {
+			numbered = fmt.Sprintf("%d: %s", lineNum, line)
+		}
+
+		stillPending := pending[:0]
+		for _, idx := range pending {
+			matches[idx].ContextAfter = append(matches[idx].ContextAfter, numbered)
+			if len(matches[idx].ContextAfter) < opts.contextLines {
+				stillPending = append(stillPending, idx)
+			}
+		}
+		pending = stillPending
+
+		if len(matches) >= opts.maxResults {
+			if len(pending) == 0 {
+				break
+			}
+			continue
+		}
+
+		if opts.re.MatchString(line) {
+			match := searchMatch{
+				File:          filePath,
+				Line:          lineNum,
+				Content:       line,
+				ContextBefore: before.snapshot(),
+			}
+			matches = append(matches, match)
+			if opts.contextLines > 0 {
+				pending = append(pending, len(matches)-1)
+			}
+		}
+
+		before.push(numbered)
+	}
+	if err := scanner.Err(); err != nil {
+		if errors.Is(err, bufio.ErrTooLong) {
+			return matches, fmt.Errorf("line %d is longer than %d bytes, searched up to it", lineNum, maxLine)
+		}
+		return matches, fmt.Errorf("read failed at line %d: %s", lineNum, err.Error())
+	}
+
+	return matches, nil
 }
 
-func searchInFile(filePath string, re *regexp.Regexp, contextLines int, limit int) ([]searchMatch, error) {
-	file, err := os.Open(filePath)
+// searchInFileMultiline matches the regex against the whole content of filePath so patterns
+// can span lines. Each match reports the lines it starts and ends on, and the full block of
+// lines it covers as content.
+func searchInFileMultiline(ctx context.Context, filePath string, opts searchOptions) ([]searchMatch, error) {
+	file, reader, err := openSearchable(filePath, opts)
 	if err != nil {
 		return nil, err
 	}
 	defer file.Close()
 
-	var lines []string
-	scanner := bufio.NewScanner(file)
-	scanner.Buffer(make([]byte, 0, 1024*1024), 10*1024*1024)
-	for scanner.Scan() {
-		lines = append(lines, scanner.Text())
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	content := string(data)
+
+	// lineStarts[i] is the byte offset where line i begins
+	lineStarts := []int{0}
+	for i := 0; i < len(content); i++ {
+		if content[i] == '\n' && i+1 < len(content) {
+			lineStarts = append(lineStarts, i+1)
+		}
+	}
+	lineAt := func(offset int) int {
+		return sort.Search(len(lineStarts), func(i int) bool { return lineStarts[i] > offset }) - 1
 	}
-	if scanner.Err() != nil {
-		return nil, scanner.Err()
+	lineText := func(line int) string {
+		end := len(content)
+		if line+1 < len(lineStarts) {
+			end = lineStarts[line+1]
+		}
+		return strings.TrimRight(content[lineStarts[line]:end], "\r\n")
 	}
 
 	var matches []searchMatch
+	for _, loc := range opts.re.FindAllStringIndex(content, opts.maxResults) {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
 
-	for i, line := range lines {
-		if len(matches) >= limit {
-			break
+		startLine := lineAt(loc[0])
+		endLine := startLine
+		if loc[1] > loc[0] {
+			endLine = lineAt(loc[1] - 1)
 		}
 
-		if !re.MatchString(line) {
-			continue
+		block := make([]string, 0, endLine-startLine+1)
+		for l := startLine; l <= endLine; l++ {
+			block = append(block, lineText(l))
 		}
 
 		match := searchMatch{
 			File:    filePath,
-			Line:    i,
-			Content: strings.TrimRight(line, "\r\n"),
+			Line:    startLine,
+			EndLine: &endLine,
+			Content: strings.Join(block, "\n"),
 		}
 
-		if contextLines > 0 {
-			start := i - contextLines
-			if start < 0 {
-				start = 0
+		if opts.contextLines > 0 {
+			for l := max(0, startLine-opts.contextLines); l < startLine; l++ {
+				match.ContextBefore = append(match.ContextBefore, fmt.Sprintf("%d: %s", l, lineText(l)))
 			}
-			for j := start; j < i; j++ {
-				match.ContextBefore = append(match.ContextBefore, fmt.Sprintf("%d: %s", j, lines[j]))
-			}
-
-			end := i + contextLines + 1
-			if end > len(lines) {
-				end = len(lines)
-			}
-			for j := i + 1; j < end; j++ {
-				match.ContextAfter = append(match.ContextAfter, fmt.Sprintf("%d: %s", j, lines[j]))
+			for l := endLine + 1; l <= endLine+opts.contextLines && l < len(lineStarts); l++ {
+				match.ContextAfter = append(match.ContextAfter, fmt.Sprintf("%d: %s", l, lineText(l)))
 			}
 		}
 
@@ -195,3 +739,78 @@ func searchInFile(filePath string, re *regexp.Regexp, contextLines int, limit in
 
 	return matches, nil
 }
+
+// openSearchable opens filePath for scanning. It returns errSearchOversize or errSearchBinary
+// when the file must be skipped because it exceeds opts.maxFileSize or looks binary.
+func openSearchable(filePath string, opts searchOptions) (*os.File, *bufio.Reader, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, nil, err
+	}
+	if opts.maxFileSize > 0 && info.Size() > opts.maxFileSize {
+		file.Close()
+		return nil, nil, errSearchOversize
+	}
+
+	reader := bufio.NewReaderSize(file, 64*1024)
+	if !opts.includeBinary {
+		head, _ := reader.Peek(binarySniffSize)
+		if isBinary(head) {
+			file.Close()
+			return nil, nil, errSearchBinary
+		}
+	}
+
+	return file, reader, nil
+}
+
+// isBinary reports whether data looks like the start of a binary file, using the same
+// heuristic as git: any NUL byte in the first few KB.
+func isBinary(data []byte) bool {
+	return bytes.IndexByte(data, 0) != -1
+}
+
+// lineRing is a fixed-size ring buffer holding the most recent lines seen while streaming a file.
+type lineRing struct {
+	lines []string
+	start int
+	count int
+}
+
+func newLineRing(size int) *lineRing {
+	if size < 0 {
+		size = 0
+	}
+	return &lineRing{lines: make([]string, size)}
+}
+
+func (r *lineRing) push(line string) {
+	if len(r.lines) == 0 {
+		return
+	}
+	if r.count < len(r.lines) {
+		r.lines[(r.start+r.count)%len(r.lines)] = line
+		r.count++
+		return
+	}
+	r.lines[r.start] = line
+	r.start = (r.start + 1) % len(r.lines)
+}
+
+// snapshot returns the buffered lines oldest first, or nil when the ring is empty.
+func (r *lineRing) snapshot() []string {
+	if r.count == 0 {
+		return nil
+	}
+	out := make([]string, r.count)
+	for i := 0; i < r.count; i++ {
+		out[i] = r.lines[(r.start+i)%len(r.lines)]
+	}
+	return out
+}
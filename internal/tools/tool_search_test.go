@@ -0,0 +1,191 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// writeSearchTree fills root with dirs directories of filesPerDir small source files,
+// one in ten of them holding a match.
+func writeSearchTree(tb testing.TB, root string, dirs, filesPerDir int) {
+	tb.Helper()
+
+	body := strings.Repeat("func handler(w http.ResponseWriter, r *http.Request) {}\n", 40)
+	for d := 0; d < dirs; d++ {
+		dir := filepath.Join(root, fmt.Sprintf("pkg%02d", d))
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			tb.Fatal(err)
+		}
+		for f := 0; f < filesPerDir; f++ {
+			content := body
+			if f%10 == 0 {
+				content += "// needle: TODO remove\n"
+			}
+			if err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("file%03d.go", f)), []byte(content), 0644); err != nil {
+				tb.Fatal(err)
+			}
+		}
+	}
+}
+
+// BenchmarkSearchTree scans a synthetic tree of a few thousand small source files, with
+// a single worker as a sequential scan would and with one worker per CPU, the default.
+func BenchmarkSearchTree(b *testing.B) {
+	root := b.TempDir()
+	const dirs, filesPerDir = 50, 80
+	writeSearchTree(b, root, dirs, filesPerDir)
+	want := dirs * filesPerDir / 10
+
+	for _, workers := range []int{1, runtime.GOMAXPROCS(0)} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			opts := searchOptions{
+				re:          regexp.MustCompile(`needle: \w+`),
+				maxResults:  dirs * filesPerDir,
+				maxFileSize: searchDefaultMaxFileSize,
+				workers:     workers,
+			}
+			for i := 0; i < b.N; i++ {
+				matches, _, err := searchTree(context.Background(), root, opts)
+				if err != nil {
+					b.Fatal(err)
+				}
+				if len(matches) != want {
+					b.Fatalf("got %d matches, want %d", len(matches), want)
+				}
+			}
+		})
+	}
+}
+
+// TestSearchTreeOrder checks that the parallel scan returns exactly what a sequential one
+// does, page after page, including pages that end in the middle of a file.
+func TestSearchTreeOrder(t *testing.T) {
+	root := t.TempDir()
+	for d := 0; d < 6; d++ {
+		dir := filepath.Join(root, fmt.Sprintf("dir%d", d))
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		for f := 0; f < 30; f++ {
+			// Files hold between 0 and 4 matches, a few of them large enough to finish last
+			var sb strings.Builder
+			lines := 10
+			if f%7 == 0 {
+				lines = 20000
+			}
+			for l := 0; l < lines; l++ {
+				if l%(lines/4+1) == 0 && (d+f)%5 != 0 {
+					fmt.Fprintf(&sb, "needle %d %d %d\n", d, f, l)
+				} else {
+					sb.WriteString("hay\n")
+				}
+			}
+			if err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("f%02d.txt", f)), []byte(sb.String()), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	tests := []struct {
+		name     string
+		pageSize int
+	}{
+		{name: "single page", pageSize: 10000},
+		{name: "pages within files", pageSize: 3},
+		{name: "pages across files", pageSize: 17},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := searchOptions{re: regexp.MustCompile(`needle`), maxResults: tt.pageSize}
+
+			sequential := opts
+			sequential.workers = 1
+			want := searchAllPages(t, root, sequential)
+
+			parallel := opts
+			parallel.workers = 8
+			got := searchAllPages(t, root, parallel)
+
+			if len(want) == 0 || strings.Join(got, "\n") != strings.Join(want, "\n") {
+				t.Fatalf("parallel scan returned %d matches, sequential %d, or in another order", len(got), len(want))
+			}
+		})
+	}
+}
+
+// searchAllPages follows the pages of a search the way HandleSearch builds its cursors,
+// and returns every match as file:line.
+func searchAllPages(t *testing.T, root string, opts searchOptions) []string {
+	t.Helper()
+
+	var all []string
+	pageSize := opts.maxResults
+	opts.maxResults = pageSize + 1
+	for {
+		matches, _, err := searchTree(context.Background(), root, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		truncated := len(matches) > pageSize
+		if truncated {
+			matches = matches[:pageSize]
+		}
+		for _, match := range matches {
+			all = append(all, fmt.Sprintf("%s:%d", match.File, match.Line))
+		}
+		if !truncated {
+			return all
+		}
+
+		last := matches[len(matches)-1].File
+		skip := 0
+		if last == opts.resumeFile {
+			skip = opts.resumeSkip
+		}
+		for _, match := range matches {
+			if match.File == last {
+				skip++
+			}
+		}
+		opts.resumeFile, opts.resumeSkip = last, skip
+	}
+}
+
+// TestSearchTreeReportsLongLines checks that a line too long to scan stops the search of
+// its file with the matches found before it kept, and the file reported as skipped.
+func TestSearchTreeReportsLongLines(t *testing.T) {
+	root := t.TempDir()
+	content := "needle one\n" + strings.Repeat("x", searchDefaultMaxFileSize+1) + "\nneedle two\n"
+	if err := os.WriteFile(filepath.Join(root, "long.txt"), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "short.txt"), []byte("needle three\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := searchOptions{re: regexp.MustCompile(`needle`), maxResults: 10}
+	matches, skipped, err := searchTree(context.Background(), root, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, match := range matches {
+		got = append(got, filepath.Base(match.File)+": "+match.Content)
+	}
+	want := []string{"long.txt: needle one", "short.txt: needle three"}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got matches %q, want %q", got, want)
+	}
+	if skipped.Unreadable != 1 || len(skipped.Files) != 1 || !strings.Contains(skipped.Files[0].Reason, "line 1 is longer") {
+		t.Errorf("got skipped %+v, want long.txt reported as unreadable from line 1", skipped)
+	}
+}
@@ -0,0 +1,178 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	//
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+var goSymbolKinds = map[string]bool{
+	"func":   true,
+	"method": true,
+	"type":   true,
+	"const":  true,
+	"var":    true,
+}
+
+func (tm *ToolsManager) HandleSymbols(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	args := request.GetArguments()
+
+	path, ok := args["path"].(string)
+	if !ok || path == "" {
+		return toolError("path parameter is required"), nil
+	}
+
+	if err := sanitizePath(path); err != nil {
+		return toolError(err.Error()), nil
+	}
+
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return toolError(fmt.Sprintf("invalid path: %s", err.Error())), nil
+	}
+
+	if err := tm.dependencies.RBAC.Check("symbols", []string{absPath}, jwtPayloadFromCtx(ctx)); err != nil {
+		return toolError(err.Error()), nil
+	}
+
+	name := ""
+	if v, ok := args["name"].(string); ok {
+		name = strings.ToLower(v)
+	}
+
+	kind := ""
+	if v, ok := args["kind"].(string); ok && v != "" {
+		if !goSymbolKinds[v] {
+			return toolError(fmt.Sprintf("unknown kind %q (valid: func, method, type, const, var)", v)), nil
+		}
+		kind = v
+	}
+
+	maxResults := 200
+	if v, ok := args["max_results"].(float64); ok && v > 0 {
+		maxResults = int(v)
+	}
+
+	gitignore := true
+	if v, ok := args["gitignore"].(bool); ok {
+		gitignore = v
+	}
+
+	info, err := os.Stat(absPath)
+	if err != nil {
+		return toolError(fmt.Sprintf("failed to stat path: %s", err.Error())), nil
+	}
+
+	matches := func(s goSymbol) bool {
+		if kind != "" && s.Kind != kind {
+			return false
+		}
+		return name == "" || strings.Contains(strings.ToLower(s.QualifiedName()), name)
+	}
+
+	// A single file returns its outline, with parse errors reported to the caller
+	if !info.IsDir() {
+		src, err := os.ReadFile(absPath)
+		if err != nil {
+			return toolError(fmt.Sprintf("failed to read file: %s", err.Error())), nil
+		}
+		symbols, err := parseGoSymbols(absPath, src)
+		if err != nil {
+			return toolError(fmt.Sprintf("failed to parse Go file: %s", err.Error())), nil
+		}
+
+		filtered := make([]goSymbol, 0, len(symbols))
+		for _, s := range symbols {
+			if matches(s) {
+				filtered = append(filtered, s)
+			}
+		}
+
+		jsonBytes, err := json.MarshalIndent(map[string]interface{}{
+			"file":    absPath,
+			"symbols": filtered,
+		}, "", "  ")
+		if err != nil {
+			return toolError(fmt.Sprintf("failed to marshal results: %s", err.Error())), nil
+		}
+		return toolSuccess(string(jsonBytes)), nil
+	}
+
+	var ignore *ignoreMatcher
+	if gitignore {
+		ignore = newIgnoreMatcher(absPath)
+	}
+
+	var symbols []goSymbol
+	var parseErrors []string
+	truncated := false
+
+	err = filepath.WalkDir(absPath, func(filePath string, d fs.DirEntry, err error) error {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+
+		if err != nil {
+			return nil
+		}
+
+		if filePath != absPath && (d.Name() == ".git" || (ignore != nil && ignore.Ignored(filePath, d.IsDir()))) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if d.IsDir() || !strings.HasSuffix(d.Name(), ".go") {
+			return nil
+		}
+
+		src, err := os.ReadFile(filePath)
+		if err != nil {
+			return nil
+		}
+		fileSymbols, err := parseGoSymbols(filePath, src)
+		if err != nil {
+			parseErrors = append(parseErrors, err.Error())
+			return nil
+		}
+
+		for _, s := range fileSymbols {
+			if !matches(s) {
+				continue
+			}
+			if len(symbols) >= maxResults {
+				truncated = true
+				return filepath.SkipAll
+			}
+			symbols = append(symbols, s)
+		}
+		return nil
+	})
+	if err != nil {
+		return toolError(fmt.Sprintf("symbol search error: %s", err.Error())), nil
+	}
+
+	result := map[string]interface{}{
+		"symbols":       symbols,
+		"total_symbols": len(symbols),
+		"truncated":     truncated,
+	}
+	if len(parseErrors) > 0 {
+		result["parse_errors"] = parseErrors
+	}
+
+	jsonBytes, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return toolError(fmt.Sprintf("failed to marshal results: %s", err.Error())), nil
+	}
+
+	return toolSuccess(string(jsonBytes)), nil
+}
@@ -27,6 +27,7 @@ func (tm *ToolsManager) HandleSystemInfo(ctx context.Context, request mcp.CallTo
 		"cwd":      cwd,
 		"shell":    os.Getenv("SHELL"),
 		"path":     os.Getenv("PATH"),
+		"undo":     tm.dependencies.Undo.Stats(),
 	}
 
 	jsonBytes, err := json.MarshalIndent(info, "", "  ")
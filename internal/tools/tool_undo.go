@@ -4,6 +4,10 @@ import (
 	"context"
 	"fmt"
 	"path/filepath"
+	"strings"
+
+	//
+	"mcp-forge/internal/state"
 
 	//
 	"github.com/mark3labs/mcp-go/mcp"
@@ -30,9 +34,84 @@ func (tm *ToolsManager) HandleUndo(ctx context.Context, request mcp.CallToolRequ
 		return toolError(err.Error()), nil
 	}
 
-	if err := tm.dependencies.Undo.Restore(absPath); err != nil {
+	steps := 1
+	if v, ok := args["steps"].(float64); ok {
+		steps = int(v)
+	}
+
+	origin := undoOriginFromCtx(ctx, "undo")
+	override := tm.undoOverride(ctx, []string{absPath})
+
+	var version *state.UndoVersion
+	if id, ok := args["version"].(string); ok && id != "" {
+		version, err = tm.dependencies.Undo.RestoreVersion(absPath, id, origin, override)
+	} else {
+		version, err = tm.dependencies.Undo.Restore(absPath, steps, origin, override)
+	}
+	if err != nil {
+		if versions := tm.dependencies.Undo.Versions(absPath, origin, override); len(versions) > 0 {
+			return toolError(err.Error() + undoVersionsSummary(versions)), nil
+		}
 		return toolError(err.Error()), nil
 	}
 
-	return toolSuccess(fmt.Sprintf("Restored %s to previous state", absPath)), nil
+	message := fmt.Sprintf("Restored %s to version %s, saved at %s", absPath, version.ID, version.CreatedAt.Format("2006-01-02 15:04:05"))
+	if !version.Existed {
+		message = fmt.Sprintf("Removed %s, which did not exist before version %s was saved", absPath, version.ID)
+	}
+
+	return toolSuccess(message + undoVersionsSummary(tm.dependencies.Undo.Versions(absPath, origin, override))), nil
+}
+
+// undoVersionsSummary lists the versions still available for a path, newest first.
+func undoVersionsSummary(versions []state.UndoVersion) string {
+	if len(versions) == 0 {
+		return "\nNo older versions remain"
+	}
+
+	ids := make([]string, 0, len(versions))
+	for i := len(versions) - 1; i >= 0; i-- {
+		ids = append(ids, fmt.Sprintf("%s (%s)", versions[i].ID, versions[i].CreatedAt.Format("15:04:05")))
+	}
+	return "\nAvailable versions, newest first: " + strings.Join(ids, ", ")
+}
+
+func (tm *ToolsManager) HandleRedo(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	args := request.GetArguments()
+
+	path, ok := args["path"].(string)
+	if !ok || path == "" {
+		return toolError("path parameter is required"), nil
+	}
+
+	if err := sanitizePath(path); err != nil {
+		return toolError(err.Error()), nil
+	}
+
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return toolError(fmt.Sprintf("invalid path: %s", err.Error())), nil
+	}
+
+	if err := tm.dependencies.RBAC.Check("redo", []string{absPath}, jwtPayloadFromCtx(ctx)); err != nil {
+		return toolError(err.Error()), nil
+	}
+
+	origin := undoOriginFromCtx(ctx, "redo")
+	override := tm.undoOverride(ctx, []string{absPath})
+
+	version, err := tm.dependencies.Undo.Redo(absPath, origin, override)
+	if err != nil {
+		return toolError(err.Error()), nil
+	}
+
+	message := fmt.Sprintf("Reapplied the undone change to %s", absPath)
+	if !version.Existed {
+		message = fmt.Sprintf("Removed %s again, as it did not exist before the undo", absPath)
+	}
+
+	if remaining := len(tm.dependencies.Undo.RedoVersions(absPath, origin, override)); remaining > 0 {
+		message += fmt.Sprintf("\nChanges left to redo: %d", remaining)
+	}
+	return toolSuccess(message), nil
 }
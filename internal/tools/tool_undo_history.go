@@ -0,0 +1,147 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	//
+	"mcp-forge/internal/state"
+
+	//
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// undoHistoryPath is the undo history of one file. Versions are listed newest first,
+// in the order undo would restore them.
+type undoHistoryPath struct {
+	Path     string               `json:"path"`
+	Exists   bool                 `json:"exists"`
+	Versions []undoHistoryVersion `json:"versions"`
+	Redo     int                  `json:"redo_available"`
+}
+
+type undoHistoryVersion struct {
+	ID        string    `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	Tool      string    `json:"tool,omitempty"`
+	Session   string    `json:"session,omitempty"`
+	Subject   string    `json:"subject,omitempty"`
+	Size      int64     `json:"size"`
+	Existed   bool      `json:"existed"`
+	Diff      string    `json:"diff,omitempty"`
+}
+
+func (tm *ToolsManager) HandleUndoHistory(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	args := request.GetArguments()
+	payload := jwtPayloadFromCtx(ctx)
+
+	withDiff := false
+	if v, ok := args["diff"].(bool); ok {
+		withDiff = v
+	}
+	contextLines := diffContextLines(args)
+
+	origin := undoOriginFromCtx(ctx, "undo_history")
+	override := func(path string) bool {
+		return tm.undoOverride(ctx, []string{path})
+	}
+
+	var paths []string
+	path, _ := args["path"].(string)
+	if path != "" {
+		if err := sanitizePath(path); err != nil {
+			return toolError(err.Error()), nil
+		}
+		absPath, err := filepath.Abs(path)
+		if err != nil {
+			return toolError(fmt.Sprintf("invalid path: %s", err.Error())), nil
+		}
+		if err := tm.dependencies.RBAC.Check("undo_history", []string{absPath}, payload); err != nil {
+			return toolError(err.Error()), nil
+		}
+		paths = []string{absPath}
+	} else {
+		// Without a path, only the history of files the caller may read is listed
+		for _, path := range tm.dependencies.Undo.Paths(origin, override) {
+			if tm.dependencies.RBAC.Check("undo_history", []string{path}, payload) == nil {
+				paths = append(paths, path)
+			}
+		}
+	}
+
+	history := make([]undoHistoryPath, 0, len(paths))
+	for _, path := range paths {
+		entry, err := tm.undoHistory(path, origin, override(path), withDiff, contextLines)
+		if err != nil {
+			return toolError(err.Error()), nil
+		}
+		history = append(history, *entry)
+	}
+
+	var result interface{} = history
+	if path != "" {
+		result = history[0]
+	}
+
+	jsonBytes, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return toolError(fmt.Sprintf("failed to marshal results: %s", err.Error())), nil
+	}
+	return toolSuccess(string(jsonBytes)), nil
+}
+
+// undoHistory describes the versions saved for path by origin, or by anyone when override
+// is set, each optionally diffed against the current content of the file.
+func (tm *ToolsManager) undoHistory(path string, origin state.UndoOrigin, override bool, withDiff bool, contextLines int) (*undoHistoryPath, error) {
+	undo := tm.dependencies.Undo
+
+	entry := &undoHistoryPath{
+		Path:     path,
+		Versions: []undoHistoryVersion{},
+		Redo:     len(undo.RedoVersions(path, origin, override)),
+	}
+
+	var current []string
+	if data, err := os.ReadFile(path); err == nil {
+		entry.Exists = true
+		current = splitLines(string(data))
+	} else if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read %s: %s", path, err.Error())
+	}
+
+	versions := undo.Versions(path, origin, override)
+	for i := len(versions) - 1; i >= 0; i-- {
+		version := versions[i]
+		item := undoHistoryVersion{
+			ID:        version.ID,
+			CreatedAt: version.CreatedAt,
+			Tool:      version.Origin.Tool,
+			Session:   version.Origin.Session,
+			Subject:   version.Origin.Subject,
+			Size:      version.Size,
+			Existed:   version.Existed,
+		}
+
+		if withDiff {
+			// The version is the old side, so the diff reads as the changes made since
+			content, existed, err := undo.VersionContent(path, version.ID, origin, override)
+			if err != nil {
+				// Dropped by a concurrent write since the listing
+				continue
+			}
+			var lines []string
+			if existed {
+				lines = splitLines(string(content))
+			}
+			item.Diff = computeDiff(fmt.Sprintf("%s (%s)", path, version.ID), path, lines, current, 0, 0, contextLines)
+		}
+
+		entry.Versions = append(entry.Versions, item)
+	}
+
+	return entry, nil
+}
@@ -36,7 +36,7 @@ func (tm *ToolsManager) HandleWriteFile(ctx context.Context, request mcp.CallToo
 		return toolError(err.Error()), nil
 	}
 
-	if err := tm.dependencies.Undo.Save(absPath); err != nil {
+	if err := tm.dependencies.Undo.Save(absPath, undoOriginFromCtx(ctx, "write_file")); err != nil {
 		tm.dependencies.AppCtx.Logger.Error("failed to save undo state", "path", absPath, "error", err.Error())
 	}
 
@@ -2,6 +2,7 @@ package tools
 
 import (
 	"mcp-forge/internal/globals"
+	"mcp-forge/internal/index"
 	"mcp-forge/internal/middlewares"
 	"mcp-forge/internal/rbac"
 	"mcp-forge/internal/state"
@@ -20,17 +21,23 @@ type ToolsManagerDependencies struct {
 	Undo        *state.UndoStore
 	Scratch     *state.ScratchStore
 	Processes   *state.ProcessStore
+	Previews    *state.PreviewStore
+	Index       *index.Manager
+	Watcher     *index.Watcher
+	Cursors     *state.CursorStore
 }
 
 type ToolsManager struct {
 	dependencies ToolsManagerDependencies
 	toolPrefix   string
+	paths        *pathCache
 }
 
 func NewToolsManager(deps ToolsManagerDependencies) *ToolsManager {
 	return &ToolsManager{
 		dependencies: deps,
 		toolPrefix:   deps.AppCtx.ToolPrefix,
+		paths:        newPathCache(deps.Watcher),
 	}
 }
 
@@ -47,10 +54,9 @@ func (tm *ToolsManager) AddTools() {
 
 	// ls
 	tm.dependencies.McpServer.AddTool(mcp.NewTool(tm.toolName("ls"),
-		mcp.WithDescription("List directory contents with optional depth, glob pattern filter, and hidden file inclusion. Use depth=1 for flat listing, depth>1 for tree view"),
+		mcp.WithDescription("List directory contents with optional depth, glob pattern filter, and hidden file inclusion. Use depth=1 for flat listing, depth>1 for tree view. When limit is given the listing is paginated and the result is {entries, truncated, next_cursor}"),
 		mcp.WithString("path",
-			mcp.Required(),
-			mcp.Description("Absolute or relative directory path to list. Must be a single concrete path — shell expansions like {a,b} are not supported"),
+			mcp.Description("Absolute or relative directory path to list. Must be a single concrete path — shell expansions like {a,b} are not supported. Required unless cursor is given"),
 		),
 		mcp.WithNumber("depth",
 			mcp.Description("Maximum depth to traverse (default: 1)"),
@@ -61,11 +67,32 @@ func (tm *ToolsManager) AddTools() {
 		mcp.WithBoolean("include_hidden",
 			mcp.Description("Include hidden files and directories (default: false)"),
 		),
+		mcp.WithNumber("limit",
+			mcp.Description("Maximum number of entries per page, counted across the whole tree. Enables pagination (default: no limit)"),
+		),
+		mcp.WithString("sort",
+			mcp.Description("Order of entries within each directory: 'name' (default, ascending), 'size' (largest first), 'mtime' (newest first) or 'type' (directories, then by extension)"),
+		),
+		mcp.WithBoolean("reverse",
+			mcp.Description("Reverse the sort order (default: false)"),
+		),
+		mcp.WithBoolean("dirs_first",
+			mcp.Description("List directories before files whatever the sort order (default: false)"),
+		),
+		mcp.WithNumber("max_per_dir",
+			mcp.Description("Show at most this many entries per directory, after sorting. The rest are summarized by a final 'N more' entry of type 'more'"),
+		),
+		mcp.WithString("format",
+			mcp.Description("Output format: 'json' (default) or 'tree' for a compact indented text tree like the tree command"),
+		),
+		mcp.WithString("cursor",
+			mcp.Description("next_cursor from a previous ls page. Resumes that listing where it stopped with the same options; other arguments are ignored. Directories from earlier pages reappear with continued=true to hold their remaining entries. Cursors expire after 10 minutes"),
+		),
 	), tm.HandleLs)
 
 	// read_file
 	tm.dependencies.McpServer.AddTool(mcp.NewTool(tm.toolName("read_file"),
-		mcp.WithDescription("Read a file's contents. Supports reading specific line ranges to save tokens. Without ranges, reads the entire file"),
+		mcp.WithDescription("Read a file's contents. Supports reading specific line ranges, or a single Go declaration by symbol name, to save tokens. Without ranges or symbol, reads the entire file"),
 		mcp.WithString("path",
 			mcp.Required(),
 			mcp.Description("Absolute or relative file path to read. Must be a single concrete path — shell expansions like {a,b} are not supported"),
@@ -73,6 +100,9 @@ func (tm *ToolsManager) AddTools() {
 		mcp.WithArray("ranges",
 			mcp.Description("Array of {offset, limit} objects for partial reads. offset is 0-based line number, limit is number of lines"),
 		),
+		mcp.WithString("symbol",
+			mcp.Description("Go files only: read a single declaration with its doc comment, by name (e.g. 'matchGlob') or Receiver.Method (e.g. 'ToolsManager.HandleSearch'). Ambiguous names list the candidates. Cannot be combined with ranges"),
+		),
 	), tm.HandleReadFile)
 
 	// write_file
@@ -103,14 +133,12 @@ func (tm *ToolsManager) AddTools() {
 
 	// search
 	tm.dependencies.McpServer.AddTool(mcp.NewTool(tm.toolName("search"),
-		mcp.WithDescription("Search for text patterns in files recursively. Returns matching file paths, line numbers, and content with configurable context"),
+		mcp.WithDescription("Search for text patterns in files recursively. Returns matching file paths, line numbers, and content with configurable context. Large result sets are paginated with next_cursor"),
 		mcp.WithString("pattern",
-			mcp.Required(),
-			mcp.Description("Search pattern (regex by default, or literal if literal=true)"),
+			mcp.Description("Search pattern (regex by default, or literal if literal=true). Required unless cursor is given"),
 		),
 		mcp.WithString("path",
-			mcp.Required(),
-			mcp.Description("Directory or file path to search in. Must be a single concrete path — shell expansions like {a,b} are not supported"),
+			mcp.Description("Directory or file path to search in. Must be a single concrete path — shell expansions like {a,b} are not supported. Required unless cursor is given"),
 		),
 		mcp.WithString("include",
 			mcp.Description("Glob pattern for files to include (e.g. '*.go')"),
@@ -125,20 +153,118 @@ func (tm *ToolsManager) AddTools() {
 			mcp.Description("Number of context lines before and after each match (default: 0)"),
 		),
 		mcp.WithNumber("max_results",
-			mcp.Description("Maximum number of matches to return (default: 100)"),
+			mcp.Description("Maximum number of matches to return per page (default: 100), or of files in files_with_matches and count modes. When more exist, the result includes next_cursor"),
+		),
+		mcp.WithString("output_mode",
+			mcp.Description("Result format: 'content' (default) is JSON with one object per match; 'files_with_matches' lists matching file paths one per line; 'count' prints path:matches per file; 'grouped' prints each file path once followed by 'line: content' rows, with context rows as 'line- content'"),
+		),
+		mcp.WithString("cursor",
+			mcp.Description("next_cursor from a previous search page. Resumes that search where it stopped with the same options; other arguments are ignored. Cursors expire after 10 minutes"),
+		),
+		mcp.WithBoolean("include_binary",
+			mcp.Description("Also search files detected as binary (default: false)"),
+		),
+		mcp.WithNumber("max_file_size",
+			mcp.Description("Skip files larger than this many bytes (default: 10485760)"),
+		),
+		mcp.WithBoolean("multiline",
+			mcp.Description("Match the pattern against the whole file so it can span lines. Use \\n or \\s to cross line breaks, or (?s) to let '.' match them. Matches report line and end_line, with the covered lines as content (default: false)"),
+		),
+		mcp.WithBoolean("gitignore",
+			mcp.Description("Skip files and directories ignored by .gitignore and .ignore files, and the .git directory (default: false)"),
 		),
 	), tm.HandleSearch)
 
+	// replace_in_files
+	tm.dependencies.McpServer.AddTool(mcp.NewTool(tm.toolName("replace_in_files"),
+		mcp.WithDescription("Search and replace across files recursively. Without apply, returns a preview of per-file diffs and a preview_token. Call again with preview_token (or apply=true) to write the changes. Saves undo state for every modified file. Files RBAC denies for writing are reported and left untouched"),
+		mcp.WithString("pattern",
+			mcp.Description("Search pattern (regex by default, or literal if literal=true). Matched against whole file content; ^ and $ match at line boundaries. Required unless preview_token is given"),
+		),
+		mcp.WithString("replacement",
+			mcp.Description("Replacement text. In regex mode $1 or ${name} expand to capture groups. Required unless preview_token is given"),
+		),
+		mcp.WithString("path",
+			mcp.Description("Directory or file path to search in. Must be a single concrete path — shell expansions like {a,b} are not supported. Required unless preview_token is given"),
+		),
+		mcp.WithString("include",
+			mcp.Description("Glob pattern for files to include (e.g. '*.go')"),
+		),
+		mcp.WithString("exclude",
+			mcp.Description("Glob pattern for files to exclude (e.g. '*.test')"),
+		),
+		mcp.WithBoolean("literal",
+			mcp.Description("Treat pattern and replacement as literal text instead of regex (default: false)"),
+		),
+		mcp.WithBoolean("gitignore",
+			mcp.Description("Skip files and directories ignored by .gitignore and .ignore files, and the .git directory (default: false)"),
+		),
+		mcp.WithNumber("max_file_size",
+			mcp.Description("Skip files larger than this many bytes (default: 10485760)"),
+		),
+		mcp.WithBoolean("apply",
+			mcp.Description("Write the changes immediately instead of returning a preview (default: false)"),
+		),
+		mcp.WithString("preview_token",
+			mcp.Description("Token returned by a previous preview. Applies exactly that change; files modified since the preview are reported as conflicts and left untouched"),
+		),
+	), tm.HandleReplaceInFiles)
+
+	// find_file
+	tm.dependencies.McpServer.AddTool(mcp.NewTool(tm.toolName("find_file"),
+		mcp.WithDescription("Find files by fuzzy name match, like fzf. Ranks paths under a directory against a query such as 'jwt utils' — every space-separated term must appear in order in the path. Matches on file names and path segment starts rank higher. Only files you can read are returned"),
+		mcp.WithString("query",
+			mcp.Required(),
+			mcp.Description("Fuzzy query. Case-insensitive unless it contains uppercase letters"),
+		),
+		mcp.WithString("path",
+			mcp.Required(),
+			mcp.Description("Directory to search under. Must be a single concrete path — shell expansions like {a,b} are not supported"),
+		),
+		mcp.WithNumber("max_results",
+			mcp.Description("Maximum number of paths to return (default: 20)"),
+		),
+		mcp.WithBoolean("gitignore",
+			mcp.Description("Skip files ignored by .gitignore and .ignore files (default: true)"),
+		),
+	), tm.HandleFindFile)
+
+	// symbols
+	tm.dependencies.McpServer.AddTool(mcp.NewTool(tm.toolName("symbols"),
+		mcp.WithDescription("List Go declarations. For a .go file, returns its outline: functions, methods with receivers, types, consts and vars with 0-based start_line and inclusive end_line. For a directory, searches declarations across all .go files by name and/or kind. Use the line ranges with read_file to read exactly one declaration"),
+		mcp.WithString("path",
+			mcp.Required(),
+			mcp.Description("Go file or directory path. Must be a single concrete path — shell expansions like {a,b} are not supported"),
+		),
+		mcp.WithString("name",
+			mcp.Description("Case-insensitive substring matched against the symbol name, or Receiver.Method for methods (e.g. 'ToolsManager.Handle')"),
+		),
+		mcp.WithString("kind",
+			mcp.Description("Only return symbols of this kind: 'func', 'method', 'type', 'const' or 'var'"),
+		),
+		mcp.WithNumber("max_results",
+			mcp.Description("Maximum number of symbols to return when searching a directory (default: 200)"),
+		),
+		mcp.WithBoolean("gitignore",
+			mcp.Description("Skip files ignored by .gitignore and .ignore files when searching a directory (default: true)"),
+		),
+	), tm.HandleSymbols)
+
 	// diff
 	tm.dependencies.McpServer.AddTool(mcp.NewTool(tm.toolName("diff"),
-		mcp.WithDescription("Compare two files or sections of files. Returns unified diff format. Supports line ranges to compare specific sections"),
+		mcp.WithDescription("Compare two files or sections of files. Returns unified diff hunks that patch accepts; each @@ header is followed by the same ranges as 0-based half-open line intervals (a[start:end] b[start:end]) matching read_file. Supports line ranges to compare specific sections. When both paths are directories, returns the added, removed and changed files (as relative paths) with a unified diff for each changed text file"),
 		mcp.WithString("path_a",
 			mcp.Required(),
-			mcp.Description("First file path. Must be a single concrete path — shell expansions like {a,b} are not supported"),
+			mcp.Description("First file or directory path. Must be a single concrete path — shell expansions like {a,b} are not supported"),
 		),
 		mcp.WithString("path_b",
-			mcp.Required(),
-			mcp.Description("Second file path. Must be a single concrete path — shell expansions like {a,b} are not supported"),
+			mcp.Description("Second file or directory path. Must be a single concrete path — shell expansions like {a,b} are not supported. Exactly one of path_b, content_b or against is required"),
+		),
+		mcp.WithString("content_b",
+			mcp.Description("Compare path_a with this inline text instead of a second file"),
+		),
+		mcp.WithString("against",
+			mcp.Description("Set to 'undo' to compare the undo snapshot of path_a (old side) with its current content (new side), to review changes made since the last write"),
 		),
 		mcp.WithNumber("start_a",
 			mcp.Description("Start line for first file (0-based, optional)"),
@@ -152,6 +278,27 @@ func (tm *ToolsManager) AddTools() {
 		mcp.WithNumber("end_b",
 			mcp.Description("End line for second file (exclusive, optional)"),
 		),
+		mcp.WithNumber("context_lines",
+			mcp.Description("Number of unchanged lines shown around each change (default: 3)"),
+		),
+		mcp.WithString("granularity",
+			mcp.Description("'line' (default), 'word' or 'char'. With word or char, each block of replaced lines is shown as '~' lines with removed text in [-...-] and added text in {+...+}"),
+		),
+		mcp.WithString("format",
+			mcp.Description("'unified' (default) for diff text, or 'json' for hunks as objects with 0-based old_start/old_count/new_start/new_count and per-line op, text, old_line and new_line. With word or char granularity each hunk also carries its inline lines"),
+		),
+		mcp.WithString("include",
+			mcp.Description("Directory mode: only compare files whose name matches this glob (e.g. '*.go')"),
+		),
+		mcp.WithString("exclude",
+			mcp.Description("Directory mode: skip files whose name matches this glob"),
+		),
+		mcp.WithBoolean("gitignore",
+			mcp.Description("Directory mode: skip files ignored by .gitignore and .ignore files on each side (default: true)"),
+		),
+		mcp.WithNumber("max_file_size",
+			mcp.Description("Directory mode: files larger than this many bytes are compared by hash only, without a diff (default: 10485760)"),
+		),
 	), tm.HandleDiff)
 
 	// exec
@@ -173,6 +320,9 @@ func (tm *ToolsManager) AddTools() {
 		mcp.WithBoolean("background",
 			mcp.Description("Run in background and return process ID (default: false)"),
 		),
+		mcp.WithBoolean("snapshot",
+			mcp.Description("Snapshot the workdir before a foreground command and report the files it added, modified and deleted. The changes become undoable, all at once through checkpoint rollback or file by file through undo, except those listed as not_undoable in large workdirs. Files ignored by .gitignore are not tracked, but files the command got ignored are still reported (default: false)"),
+		),
 	), tm.HandleExec)
 
 	// process_status
@@ -192,18 +342,103 @@ func (tm *ToolsManager) AddTools() {
 		),
 	), tm.HandleProcessKill)
 
+	// merge
+	tm.dependencies.McpServer.AddTool(mcp.NewTool(tm.toolName("merge"),
+		mcp.WithDescription("Three-way merge of base, ours and theirs. Changes made on only one side are applied; regions changed differently on both sides become conflicts. Each version comes from exactly one of <side>_path, <side>_content or <side>_undo. Returns the merged text with <<<<<<< ======= >>>>>>> markers, or a structured conflict list. Can write the result back to path, saving undo state"),
+		mcp.WithString("base_path",
+			mcp.Description("File holding the common ancestor"),
+		),
+		mcp.WithString("base_content",
+			mcp.Description("The common ancestor as inline text"),
+		),
+		mcp.WithString("base_undo",
+			mcp.Description("Use the undo snapshot of this file path as the common ancestor"),
+		),
+		mcp.WithString("ours_path",
+			mcp.Description("File holding the our version"),
+		),
+		mcp.WithString("ours_content",
+			mcp.Description("The our version as inline text"),
+		),
+		mcp.WithString("ours_undo",
+			mcp.Description("Use the undo snapshot of this file path as the our version"),
+		),
+		mcp.WithString("theirs_path",
+			mcp.Description("File holding the their version"),
+		),
+		mcp.WithString("theirs_content",
+			mcp.Description("The their version as inline text"),
+		),
+		mcp.WithString("theirs_undo",
+			mcp.Description("Use the undo snapshot of this file path as the their version"),
+		),
+		mcp.WithString("path",
+			mcp.Description("File to write the merged result to when write is true. Must be a single concrete path — shell expansions like {a,b} are not supported"),
+		),
+		mcp.WithBoolean("write",
+			mcp.Description("Write the merged result, including any conflict markers, to path (default: false). Requires write permission on path and can be reverted with undo"),
+		),
+		mcp.WithString("format",
+			mcp.Description("'markers' (default) returns the merged text; 'json' returns {clean, conflicts, merged} where each conflict has 0-based base_start/ours_start/theirs_start, the lines of each side, and merged_start, the line of its opening marker"),
+		),
+		mcp.WithBoolean("diff3",
+			mcp.Description("Also show the base version inside each conflict, between ||||||| and ======= (default: false)"),
+		),
+	), tm.HandleMerge)
+
 	// undo
 	tm.dependencies.McpServer.AddTool(mcp.NewTool(tm.toolName("undo"),
-		mcp.WithDescription("Undo the last write_file or edit_file operation on a specific file path. Restores the file to its state before the last modification"),
+		mcp.WithDescription("Undo write_file, edit_file, replace_in_files or merge operations on a specific file path. Each write keeps a version of the previous content; by default the file goes back to its state before the last modification"),
 		mcp.WithString("path",
 			mcp.Required(),
 			mcp.Description("File path to undo changes for. Must be a single concrete path — shell expansions like {a,b} are not supported"),
 		),
+		mcp.WithNumber("steps",
+			mcp.Description("Number of modifications to undo at once (default: 1)"),
+		),
+		mcp.WithString("version",
+			mcp.Description("ID of the version to restore, as listed in undo results; overrides steps. Newer versions are discarded"),
+		),
 	), tm.HandleUndo)
 
+	// redo
+	tm.dependencies.McpServer.AddTool(mcp.NewTool(tm.toolName("redo"),
+		mcp.WithDescription("Reapply the change most recently reverted by undo on a specific file path. Repeat to move forward through several undone steps. Any new write to the file clears what can be redone"),
+		mcp.WithString("path",
+			mcp.Required(),
+			mcp.Description("File path to redo changes for. Must be a single concrete path — shell expansions like {a,b} are not supported"),
+		),
+	), tm.HandleRedo)
+
+	// undo_history
+	tm.dependencies.McpServer.AddTool(mcp.NewTool(tm.toolName("undo_history"),
+		mcp.WithDescription("List the undo versions saved by this session for a file, or for every file with history, newest first: version ID, timestamp, the tool whose write saved it, the session and subject that issued that write, and the size. Optionally diffs each version against the current content, to see what undo would bring back before running it"),
+		mcp.WithString("path",
+			mcp.Description("File path to list versions for. Omit to list every file with undo history"),
+		),
+		mcp.WithBoolean("diff",
+			mcp.Description("Include a unified diff from each version to the current content (default: false)"),
+		),
+		mcp.WithNumber("context_lines",
+			mcp.Description("Unchanged lines shown around each change in diffs (default: 3)"),
+		),
+	), tm.HandleUndoHistory)
+
+	// checkpoint
+	tm.dependencies.McpServer.AddTool(mcp.NewTool(tm.toolName("checkpoint"),
+		mcp.WithDescription("Named checkpoints spanning many files. After 'create', every file written, edited, created or deleted through the tools is tracked; 'rollback' puts all of them back to their state at checkpoint time in one operation and reports each file affected. Use before a multi-file refactor that may need to be discarded"),
+		mcp.WithString("action",
+			mcp.Required(),
+			mcp.Description("Action to perform: 'create', 'list', 'rollback', or 'delete'"),
+		),
+		mcp.WithString("name",
+			mcp.Description("Checkpoint name, unique among the checkpoints of this session (required for create, rollback, delete)"),
+		),
+	), tm.HandleCheckpoint)
+
 	// scratch
 	tm.dependencies.McpServer.AddTool(mcp.NewTool(tm.toolName("scratch"),
-		mcp.WithDescription("In-memory key-value store for temporary data. Use to save snippets, plans, or intermediate results between tool calls without retransmitting them"),
+		mcp.WithDescription("In-memory key-value store for temporary data. Use to save snippets, plans, or intermediate results between tool calls without retransmitting them. The number of keys and total size are limited; 'list' returns each key with its value, size and remaining TTL"),
 		mcp.WithString("action",
 			mcp.Required(),
 			mcp.Description("Action to perform: 'set', 'get', 'delete', or 'list'"),
@@ -214,5 +449,8 @@ func (tm *ToolsManager) AddTools() {
 		mcp.WithString("value",
 			mcp.Description("Value to store (required for set)"),
 		),
+		mcp.WithNumber("ttl_seconds",
+			mcp.Description("Seconds after which the key expires, at most 30 days (set only; default: never)"),
+		),
 	), tm.HandleScratch)
 }